@@ -0,0 +1,233 @@
+package urlfilter
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// clientsModifier is the parsed value of the $client modifier.
+// Clients can be specified by IP address, CIDR or name: 192.168.1.0/24|'Kids tablet'|~192.168.1.5
+// https://github.com/AdguardTeam/AdGuardHome/wiki/Hosts-Blocklists#client
+type clientsModifier struct {
+	text string // original modifier value
+
+	permittedNames  []string     // permitted client names
+	permittedNets   []*net.IPNet // permitted client IP addresses and subnets
+	restrictedNames []string     // restricted client names
+	restrictedNets  []*net.IPNet // restricted client IP addresses and subnets
+}
+
+// parseClientsModifier parses the $client modifier value.
+// Client names containing special characters should be quoted.
+func parseClientsModifier(value string) (*clientsModifier, error) {
+	clients, err := splitClients(value)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &clientsModifier{
+		text: value,
+	}
+
+	for _, client := range clients {
+		restricted := strings.HasPrefix(client, "~")
+		if restricted {
+			client = client[1:]
+		}
+
+		client = unquoteClientName(client)
+		if client == "" {
+			return nil, fmt.Errorf("empty client specified: %s", value)
+		}
+
+		ipNet := parseClientNet(client)
+		switch {
+		case ipNet != nil && restricted:
+			m.restrictedNets = append(m.restrictedNets, ipNet)
+		case ipNet != nil:
+			m.permittedNets = append(m.permittedNets, ipNet)
+		case restricted:
+			m.restrictedNames = append(m.restrictedNames, client)
+		default:
+			m.permittedNames = append(m.permittedNames, client)
+		}
+	}
+
+	return m, nil
+}
+
+// splitClients splits the $client modifier value by "|" ignoring the separators inside of the quotes
+func splitClients(value string) ([]string, error) {
+	if value == "" {
+		return nil, fmt.Errorf("no clients specified")
+	}
+
+	var clients []string
+	var sb strings.Builder
+	var quote byte
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			sb.WriteByte(c)
+		case c == '\'' || c == '"':
+			quote = c
+			sb.WriteByte(c)
+		case c == '|':
+			clients = append(clients, sb.String())
+			sb.Reset()
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unclosed quote in clients list: %s", value)
+	}
+
+	return append(clients, sb.String()), nil
+}
+
+// unquoteClientName removes the quotes around the client name
+func unquoteClientName(name string) string {
+	if len(name) >= 2 && (name[0] == '\'' || name[0] == '"') && name[len(name)-1] == name[0] {
+		return name[1 : len(name)-1]
+	}
+	return name
+}
+
+// parseClientNet parses the IP address or CIDR. It returns nil if this is not an IP address.
+func parseClientNet(client string) *net.IPNet {
+	if _, ipNet, err := net.ParseCIDR(client); err == nil {
+		return ipNet
+	}
+
+	ip := net.ParseIP(client)
+	if ip == nil {
+		return nil
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// match checks if the client with the specified IP address and name matches the modifier
+func (m *clientsModifier) match(ip net.IP, name string) bool {
+	if m == nil {
+		return true
+	}
+
+	if matchClient(ip, name, m.restrictedNets, m.restrictedNames) {
+		return false
+	}
+
+	if len(m.permittedNets) == 0 && len(m.permittedNames) == 0 {
+		return true
+	}
+
+	return matchClient(ip, name, m.permittedNets, m.permittedNames)
+}
+
+// String returns the original modifier value or an empty string for nil
+func (m *clientsModifier) String() string {
+	if m == nil {
+		return ""
+	}
+	return m.text
+}
+
+// matchClient checks if the client is in the specified list of subnets or names
+func matchClient(ip net.IP, name string, nets []*net.IPNet, names []string) bool {
+	if ip != nil {
+		for _, ipNet := range nets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	return name != "" && stringArrayContains(names, name)
+}
+
+// clientTagsModifier is the parsed value of the $ctag modifier: device_phone|~user_child
+// https://github.com/AdguardTeam/AdGuardHome/wiki/Hosts-Blocklists#ctag
+type clientTagsModifier struct {
+	text string // original modifier value
+
+	permitted  []string // permitted client tags
+	restricted []string // restricted client tags
+}
+
+// parseClientTagsModifier parses the $ctag modifier value.
+// Tags can contain lowercase letters, digits and "_".
+func parseClientTagsModifier(value string) (*clientTagsModifier, error) {
+	if value == "" {
+		return nil, fmt.Errorf("no client tags specified")
+	}
+
+	m := &clientTagsModifier{
+		text: value,
+	}
+
+	for _, tag := range strings.Split(value, "|") {
+		restricted := strings.HasPrefix(tag, "~")
+		if restricted {
+			tag = tag[1:]
+		}
+
+		if !isValidClientTag(tag) {
+			return nil, fmt.Errorf("invalid client tag: %s", tag)
+		}
+
+		if restricted {
+			m.restricted = append(m.restricted, tag)
+		} else {
+			m.permitted = append(m.permitted, tag)
+		}
+	}
+
+	return m, nil
+}
+
+// isValidClientTag checks if the string is a valid client tag
+func isValidClientTag(tag string) bool {
+	if tag == "" {
+		return false
+	}
+
+	for _, c := range tag {
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// match checks if the client with the specified tags matches the modifier
+func (m *clientTagsModifier) match(tags []string) bool {
+	if m == nil {
+		return true
+	}
+
+	if stringArraysHaveIntersection(m.restricted, tags) {
+		return false
+	}
+
+	return len(m.permitted) == 0 || stringArraysHaveIntersection(m.permitted, tags)
+}
+
+// String returns the original modifier value or an empty string for nil
+func (m *clientTagsModifier) String() string {
+	if m == nil {
+		return ""
+	}
+	return m.text
+}
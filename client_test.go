@@ -0,0 +1,58 @@
+package urlfilter
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseClientsModifier(t *testing.T) {
+	m, err := parseClientsModifier("192.168.1.0/24|'Kids tablet'|~192.168.1.5|\"a|b\"|2000::1")
+	assert.Nil(t, err)
+	assert.NotNil(t, m)
+	assert.Equal(t, []string{"Kids tablet", "a|b"}, m.permittedNames)
+	assert.Len(t, m.permittedNets, 2)
+	assert.Len(t, m.restrictedNets, 1)
+
+	assert.True(t, m.match(net.ParseIP("192.168.1.1"), ""))
+	assert.False(t, m.match(net.ParseIP("192.168.1.5"), ""))
+	assert.False(t, m.match(net.ParseIP("192.168.2.1"), ""))
+	assert.True(t, m.match(net.ParseIP("2000::1"), ""))
+	assert.True(t, m.match(net.ParseIP("10.0.0.1"), "Kids tablet"))
+	assert.True(t, m.match(nil, "a|b"))
+	assert.False(t, m.match(nil, "kids tablet"))
+	assert.False(t, m.match(nil, ""))
+
+	m, err = parseClientsModifier("~'Parents laptop'")
+	assert.Nil(t, err)
+	assert.True(t, m.match(nil, ""))
+	assert.False(t, m.match(nil, "Parents laptop"))
+
+	_, err = parseClientsModifier("")
+	assert.NotNil(t, err)
+	_, err = parseClientsModifier("'unclosed")
+	assert.NotNil(t, err)
+	_, err = parseClientsModifier("192.168.1.1|")
+	assert.NotNil(t, err)
+}
+
+func TestParseClientTagsModifier(t *testing.T) {
+	m, err := parseClientTagsModifier("device_phone|~user_child")
+	assert.Nil(t, err)
+	assert.NotNil(t, m)
+	assert.True(t, m.match([]string{"device_phone"}))
+	assert.False(t, m.match([]string{"device_phone", "user_child"}))
+	assert.False(t, m.match([]string{"device_pc"}))
+	assert.False(t, m.match(nil))
+
+	m, err = parseClientTagsModifier("~user_child")
+	assert.Nil(t, err)
+	assert.True(t, m.match(nil))
+	assert.False(t, m.match([]string{"user_child"}))
+
+	_, err = parseClientTagsModifier("")
+	assert.NotNil(t, err)
+	_, err = parseClientTagsModifier("Device Phone")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,174 @@
+package urlfilter
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// cookieModifier is the parsed value of the $cookie modifier: name;maxAge=3600;sameSite=lax
+// https://kb.adguard.com/en/general/how-to-create-your-own-ad-filters#cookie-modifier
+type cookieModifier struct {
+	text     string         // original modifier value
+	name     string         // cookie name. If both name and regex are empty, the rule matches all cookies.
+	regex    *regexp.Regexp // regular expression matching the cookie name
+	maxAge   int            // if greater than 0, the cookie lifetime is limited instead of removing the cookie
+	sameSite http.SameSite  // if set, the SameSite attribute is rewritten instead of removing the cookie
+}
+
+// parseCookieModifier parses the $cookie modifier value
+func parseCookieModifier(value string) (*cookieModifier, error) {
+	m := &cookieModifier{
+		text: value,
+	}
+
+	// The regex may contain ";" so it is extracted before the options are split.
+	// The options never contain "/", so the regex ends with the last one.
+	name := value
+	options := ""
+	if end := strings.LastIndex(value, maskRegexRule); end > 0 && strings.HasPrefix(value, maskRegexRule) {
+		name = value[:end+1]
+		options = value[end+1:]
+		if options != "" && !strings.HasPrefix(options, ";") {
+			return nil, fmt.Errorf("invalid $cookie regex: %s", value)
+		}
+	} else if index := strings.Index(value, ";"); index >= 0 {
+		name = value[:index]
+		options = value[index:]
+	}
+
+	name = strings.TrimSpace(name)
+	if strings.HasPrefix(name, maskRegexRule) && strings.HasSuffix(name, maskRegexRule) && len(name) > 1 {
+		re, err := regexp.Compile(name[1 : len(name)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid $cookie regex: %s", err)
+		}
+		m.regex = re
+	} else {
+		m.name = name
+	}
+
+	if options == "" {
+		return m, nil
+	}
+
+	for _, part := range strings.Split(options[1:], ";") {
+		part = strings.TrimSpace(part)
+		index := strings.Index(part, "=")
+		if index <= 0 {
+			return nil, fmt.Errorf("invalid $cookie option: %s", part)
+		}
+
+		optionName := part[:index]
+		optionValue := part[index+1:]
+		switch optionName {
+		case "maxAge":
+			maxAge, err := strconv.Atoi(optionValue)
+			if err != nil || maxAge <= 0 {
+				return nil, fmt.Errorf("invalid $cookie maxAge: %s", optionValue)
+			}
+			m.maxAge = maxAge
+		case "sameSite":
+			switch strings.ToLower(optionValue) {
+			case "lax":
+				m.sameSite = http.SameSiteLaxMode
+			case "strict":
+				m.sameSite = http.SameSiteStrictMode
+			case "none":
+				m.sameSite = http.SameSiteNoneMode
+			default:
+				return nil, fmt.Errorf("invalid $cookie sameSite: %s", optionValue)
+			}
+		default:
+			return nil, fmt.Errorf("unknown $cookie option: %s", optionName)
+		}
+	}
+
+	return m, nil
+}
+
+// match checks if the cookie with the specified name matches the modifier
+func (m *cookieModifier) match(name string) bool {
+	if m.regex != nil {
+		return m.regex.MatchString(name)
+	}
+	return m.name == "" || m.name == name
+}
+
+// isModifying returns true if the modifier rewrites cookies instead of removing them
+func (m *cookieModifier) isModifying() bool {
+	return m.maxAge > 0 || m.sameSite != 0
+}
+
+// modify returns a copy of the cookie with the modifier options applied
+func (m *cookieModifier) modify(c *http.Cookie) *http.Cookie {
+	modified := *c
+	if m.maxAge > 0 && (modified.MaxAge == 0 || modified.MaxAge > m.maxAge) {
+		modified.MaxAge = m.maxAge
+	}
+	if m.sameSite != 0 {
+		modified.SameSite = m.sameSite
+	}
+	return &modified
+}
+
+// sortCookieRules moves the rules removing cookies before the rules rewriting them,
+// so that the former are kept when the rules for the same cookie are deduplicated
+func sortCookieRules(rules []*NetworkRule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		return !rules[i].cookie.isModifying() && rules[j].cookie.isModifying()
+	})
+}
+
+// FilterRequestCookies removes the cookies blocked by the $cookie rules
+// from the cookies sent with the request (the Cookie header).
+// Rules that limit the cookie lifetime or change the SameSite attribute do not affect these cookies.
+func (m *MatchingResult) FilterRequestCookies(cookies []*http.Cookie) []*http.Cookie {
+	var result []*http.Cookie
+	for _, c := range cookies {
+		rule := m.GetCookieRule(c.Name)
+		if rule == nil || rule.cookie.isModifying() {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// FilterResponseCookies removes or rewrites the cookies set by the response (the Set-Cookie header).
+// Modified cookies are copies, the original cookies are not changed.
+func (m *MatchingResult) FilterResponseCookies(cookies []*http.Cookie) []*http.Cookie {
+	var result []*http.Cookie
+	for _, c := range cookies {
+		rule := m.GetCookieRule(c.Name)
+		if rule == nil {
+			result = append(result, c)
+		} else if rule.cookie.isModifying() {
+			result = append(result, rule.cookie.modify(c))
+		}
+	}
+	return result
+}
+
+// GetCookieRule returns the $cookie rule that should be applied to the cookie with the specified name.
+// Rules removing the cookie have priority over the rules rewriting it.
+// It returns nil if the cookie should not be changed.
+func (m *MatchingResult) GetCookieRule(name string) *NetworkRule {
+	var result *NetworkRule
+	for _, rule := range m.CookieRules {
+		if !rule.cookie.match(name) {
+			continue
+		}
+
+		if !rule.cookie.isModifying() {
+			return rule
+		}
+
+		if result == nil {
+			result = rule
+		}
+	}
+	return result
+}
@@ -0,0 +1,120 @@
+package urlfilter
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCookieModifier(t *testing.T) {
+	m, err := parseCookieModifier("")
+	assert.Nil(t, err)
+	assert.True(t, m.match("any"))
+	assert.False(t, m.isModifying())
+
+	m, err = parseCookieModifier("NAME")
+	assert.Nil(t, err)
+	assert.True(t, m.match("NAME"))
+	assert.False(t, m.match("name"))
+
+	m, err = parseCookieModifier("/^_ga/")
+	assert.Nil(t, err)
+	assert.True(t, m.match("_ga_123"))
+	assert.False(t, m.match("ga"))
+
+	m, err = parseCookieModifier("NAME;maxAge=3600;sameSite=lax")
+	assert.Nil(t, err)
+	assert.Equal(t, "NAME", m.name)
+	assert.Equal(t, 3600, m.maxAge)
+	assert.Equal(t, http.SameSiteLaxMode, m.sameSite)
+	assert.True(t, m.isModifying())
+
+	_, err = parseCookieModifier("NAME;maxAge=abc")
+	assert.NotNil(t, err)
+	_, err = parseCookieModifier("NAME;sameSite=unknown")
+	assert.NotNil(t, err)
+	_, err = parseCookieModifier("NAME;unknown=1")
+	assert.NotNil(t, err)
+	_, err = parseCookieModifier("/(/")
+	assert.NotNil(t, err)
+
+	// The regex may contain ";"
+	m, err = parseCookieModifier("/a;b/;maxAge=10")
+	assert.Nil(t, err)
+	assert.True(t, m.match("xa;by"))
+	assert.False(t, m.match("a"))
+	assert.Equal(t, 10, m.maxAge)
+
+	m, err = parseCookieModifier("/^_ga;/")
+	assert.Nil(t, err)
+	assert.True(t, m.match("_ga;1"))
+	assert.False(t, m.isModifying())
+
+	_, err = parseCookieModifier("/a/b;maxAge=10")
+	assert.NotNil(t, err)
+
+	rule, err := NewNetworkRule("||example.org^$cookie=/a;b/;maxAge=10", -1)
+	assert.Nil(t, err)
+	assert.NotNil(t, rule)
+}
+
+func TestMatchingResultCookies(t *testing.T) {
+	removeRule, err := NewNetworkRule("||example.org^$cookie=/^_ga/", -1)
+	assert.Nil(t, err)
+	modifyRule, err := NewNetworkRule("||example.org^$cookie=session;maxAge=3600;sameSite=strict", -1)
+	assert.Nil(t, err)
+
+	// $cookie rules do not block the request
+	res := NewMatchingResult([]*NetworkRule{removeRule, modifyRule}, nil)
+	assert.Nil(t, res.GetBasicResult())
+	assert.Equal(t, removeRule, res.GetCookieRule("_ga_1"))
+	assert.Equal(t, modifyRule, res.GetCookieRule("session"))
+	assert.Nil(t, res.GetCookieRule("other"))
+
+	gaCookie := &http.Cookie{Name: "_ga_1", Value: "1"}
+	sessionCookie := &http.Cookie{Name: "session", Value: "2", MaxAge: 86400}
+	otherCookie := &http.Cookie{Name: "other", Value: "3"}
+	cookies := []*http.Cookie{gaCookie, sessionCookie, otherCookie}
+
+	// Modifying rules do not affect the request cookies
+	assert.Equal(t, []*http.Cookie{sessionCookie, otherCookie}, res.FilterRequestCookies(cookies))
+
+	filtered := res.FilterResponseCookies(cookies)
+	assert.Len(t, filtered, 2)
+	assert.Equal(t, "session", filtered[0].Name)
+	assert.Equal(t, 3600, filtered[0].MaxAge)
+	assert.Equal(t, http.SameSiteStrictMode, filtered[0].SameSite)
+	assert.Equal(t, 86400, sessionCookie.MaxAge)
+	assert.Equal(t, otherCookie, filtered[1])
+
+	// Whitelist rule disables the rule with the same value
+	whitelistRule, err := NewNetworkRule("@@||example.org^$cookie=/^_ga/", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{removeRule, modifyRule, whitelistRule}, nil)
+	assert.Equal(t, []*NetworkRule{modifyRule}, res.CookieRules)
+
+	// Whitelist rule without a value disables all of them
+	whitelistRule, err = NewNetworkRule("@@||example.org^$cookie", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{removeRule, modifyRule, whitelistRule}, nil)
+	assert.Empty(t, res.CookieRules)
+	assert.Equal(t, cookies, res.FilterResponseCookies(cookies))
+
+	// Whitelist rule disables the rules for the same cookie regardless of their options
+	whitelistRule, err = NewNetworkRule("@@||example.org^$cookie=session", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{removeRule, modifyRule, whitelistRule}, nil)
+	assert.Equal(t, []*NetworkRule{removeRule}, res.CookieRules)
+
+	// Rules for the same cookie are applied once, removing rules are preferred
+	otherModifyRule, err := NewNetworkRule("||example.org^$cookie=session;maxAge=60", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{modifyRule, otherModifyRule}, nil)
+	assert.Equal(t, []*NetworkRule{modifyRule}, res.CookieRules)
+
+	removeSessionRule, err := NewNetworkRule("||example.org^$cookie=session", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{modifyRule, removeSessionRule}, nil)
+	assert.Equal(t, []*NetworkRule{removeSessionRule}, res.CookieRules)
+}
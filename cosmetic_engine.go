@@ -1,41 +1,59 @@
 package urlfilter
 
+// elementHidingStyle is the style that is used to hide the elements matching element hiding rules
+const elementHidingStyle = " { display: none !important; }"
+
 // CosmeticEngine combines all the cosmetic rules and allows to quickly
 // find all rules matching this or that hostname
 type CosmeticEngine struct {
+	RulesCount int // RulesCount -- count of rules added to the engine
+
 	lookupTables map[CosmeticRuleType]*cosmeticLookupTable
 }
 
-// NewCosmeticEngine builds a new cosmetic engine from the list of rules
-func NewCosmeticEngine(rules []*CosmeticRule) *CosmeticEngine {
+// NewCosmeticEngine builds a new cosmetic engine from the rules in the specified storage
+func NewCosmeticEngine(s *RuleStorage) *CosmeticEngine {
 	engine := CosmeticEngine{
 		lookupTables: map[CosmeticRuleType]*cosmeticLookupTable{
 			CosmeticElementHiding: newCosmeticLookupTable(),
 			CosmeticCSS:           newCosmeticLookupTable(),
 			CosmeticJS:            newCosmeticLookupTable(),
+			CosmeticHTML:          newCosmeticLookupTable(),
 		},
 	}
 
-	for _, rule := range rules {
-		switch rule.Type {
-		case CosmeticElementHiding:
-			engine.lookupTables[CosmeticElementHiding].addRule(rule)
-		default:
-			// TODO: Implement
-			// ignore
+	scanner := s.NewRuleStorageScanner()
+	for scanner.Scan() {
+		f, _ := scanner.Rule()
+		rule, ok := f.(*CosmeticRule)
+		if ok {
+			engine.addRule(rule)
 		}
 	}
 
 	return &engine
 }
 
+// addRule adds the rule to the corresponding lookup table
+func (e *CosmeticEngine) addRule(f *CosmeticRule) {
+	switch f.Type {
+	case CosmeticElementHiding, CosmeticCSS, CosmeticJS, CosmeticHTML:
+		e.lookupTables[f.Type].addRule(f)
+		e.RulesCount++
+	default:
+		// TODO: Implement
+		// ignore
+	}
+}
+
 // CosmeticResult represents all scripts and styles that needs to be injected into the page
 type CosmeticResult struct {
-	StylesSpecific       []string // Styles specific to the hostname
-	StylesGeneric        []string // Styles combined of generic cosmetic rules
-	StylesSpecificExtCSS []string // ExtCSS styles specific to the hostname
-	StylesGenericExtCSS  []string // ExtCSS styles combined of generic rules
-	Scripts              []string // Scripts to inject
+	StylesSpecific       []string     // Styles specific to the hostname
+	StylesGeneric        []string     // Styles combined of generic cosmetic rules
+	StylesSpecificExtCSS []string     // ExtCSS styles specific to the hostname
+	StylesGenericExtCSS  []string     // ExtCSS styles combined of generic rules
+	Scripts              []string     // Scripts to inject
+	Scriptlets           []*Scriptlet // Parsed scriptlets, their text representation is in Scripts
 }
 
 // Match builds scripts and styles that needs to be injected into the specified page
@@ -46,10 +64,54 @@ type CosmeticResult struct {
 func (e *CosmeticEngine) Match(hostname string, includeCSS bool, includeGenericCSS bool, includeJS bool) *CosmeticResult {
 	r := &CosmeticResult{}
 
-	// TODO: Build result
+	if includeCSS {
+		e.lookupTables[CosmeticElementHiding].buildResult(hostname, includeGenericCSS, r)
+		e.lookupTables[CosmeticCSS].buildResult(hostname, includeGenericCSS, r)
+	}
+
+	if includeJS {
+		e.lookupTables[CosmeticJS].buildResult(hostname, true, r)
+	}
+
 	return r
 }
 
+// MatchHTML returns HTML filtering rules that should be applied to the specified page
+// hostname is the page hostname
+func (e *CosmeticEngine) MatchHTML(hostname string) []*CosmeticRule {
+	table := e.lookupTables[CosmeticHTML]
+	return append(table.findGeneric(hostname), table.findByHostname(hostname)...)
+}
+
+// appendRule adds the content of the specified rule to the result
+// generic defines if this is a generic rule or a domain-specific one
+func (r *CosmeticResult) appendRule(f *CosmeticRule, generic bool) {
+	var style string
+	switch f.Type {
+	case CosmeticElementHiding:
+		style = f.Content + elementHidingStyle
+	case CosmeticCSS:
+		style = f.Content
+	case CosmeticJS:
+		r.Scripts = append(r.Scripts, f.Content)
+		r.Scriptlets = append(r.Scriptlets, f.Scriptlet)
+		return
+	default:
+		return
+	}
+
+	switch {
+	case f.ExtendedCSS && generic:
+		r.StylesGenericExtCSS = append(r.StylesGenericExtCSS, style)
+	case f.ExtendedCSS:
+		r.StylesSpecificExtCSS = append(r.StylesSpecificExtCSS, style)
+	case generic:
+		r.StylesGeneric = append(r.StylesGeneric, style)
+	default:
+		r.StylesSpecific = append(r.StylesSpecific, style)
+	}
+}
+
 // cosmeticLookupTable is a helper structure to speed up cosmetic rules matching
 type cosmeticLookupTable struct {
 	byHostname   map[string][]*CosmeticRule // map with rules grouped by the permitted domains names
@@ -88,13 +150,90 @@ func (c *cosmeticLookupTable) addRule(f *CosmeticRule) {
 }
 
 // buildResult adds data to the cosmetic result instance
-func (c *cosmeticLookupTable) buildResult(hostname string, r *CosmeticResult) {
-	// TODO: Implement
+// includeGeneric defines if generic rules should be added to the result
+func (c *cosmeticLookupTable) buildResult(hostname string, includeGeneric bool, r *CosmeticResult) {
+	if includeGeneric {
+		for _, rule := range c.findGeneric(hostname) {
+			r.appendRule(rule, true)
+		}
+	}
+
+	for _, rule := range c.findByHostname(hostname) {
+		r.appendRule(rule, false)
+	}
+}
+
+// findGeneric looks for matching generic rules
+// and skips the rules disabled by the whitelist rules.
+func (c *cosmeticLookupTable) findGeneric(hostname string) []*CosmeticRule {
+	var rules []*CosmeticRule
+
+	for _, rule := range c.genericRules {
+		if rule.Match(hostname) && !c.isWhitelisted(hostname, rule) {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
 }
 
 // findByHostname looks for matching domain-specific rules
+// It walks through the hostname and all its parent domains,
+// and skips the rules disabled by the whitelist rules.
 func (c *cosmeticLookupTable) findByHostname(hostname string) []*CosmeticRule {
 	var rules []*CosmeticRule
-	// TODO: Implement
+
+	for _, domain := range getSubdomains(hostname) {
+		for _, rule := range c.byHostname[domain] {
+			if !rule.Match(hostname) || c.isWhitelisted(hostname, rule) {
+				continue
+			}
+
+			// A rule with several permitted domains may be found more than once
+			if !containsCosmeticRule(rules, rule) {
+				rules = append(rules, rule)
+			}
+		}
+	}
+
 	return rules
 }
+
+// isWhitelisted checks if the rule is disabled on the specified hostname
+// by a whitelist rule with the same content.
+// Scriptlets can also be disabled by an exception with the scriptlet name only.
+func (c *cosmeticLookupTable) isWhitelisted(hostname string, f *CosmeticRule) bool {
+	if c.isWhitelistedContent(hostname, f.Content) {
+		return true
+	}
+
+	if f.Scriptlet != nil && len(f.Scriptlet.Args) > 0 {
+		nameOnly := &Scriptlet{Name: f.Scriptlet.Name}
+		return c.isWhitelistedContent(hostname, nameOnly.String())
+	}
+
+	return false
+}
+
+// isWhitelistedContent checks if there is a whitelist rule with the specified content
+// that can be applied to the hostname
+func (c *cosmeticLookupTable) isWhitelistedContent(hostname string, content string) bool {
+	for _, rule := range c.whitelist[content] {
+		if rule.Match(hostname) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsCosmeticRule checks if the specified rule is already in the array
+func containsCosmeticRule(rules []*CosmeticRule, f *CosmeticRule) bool {
+	for _, rule := range rules {
+		if rule == f {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,136 @@
+package urlfilter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCosmeticEngineMatchElementHiding(t *testing.T) {
+	rulesText := strings.Join([]string{
+		"##.generic",
+		"##.disabled-generic",
+		"~example.org##.generic-restricted",
+		"example.org##.specific",
+		"example.org,sub.example.org##.specific-multi",
+		"sub.example.org##.specific-sub",
+		"example.org#@#.disabled-generic",
+		"sub.example.org#@#.specific",
+	}, "\n")
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	engine := NewCosmeticEngine(ruleStorage)
+	assert.Equal(t, 8, engine.RulesCount)
+
+	r := engine.Match("example.org", true, true, true)
+	assert.Equal(t, []string{".generic { display: none !important; }"}, r.StylesGeneric)
+	assert.Equal(t, []string{
+		".specific { display: none !important; }",
+		".specific-multi { display: none !important; }",
+	}, r.StylesSpecific)
+
+	r = engine.Match("sub.example.org", true, true, true)
+	assert.Equal(t, []string{".generic { display: none !important; }"}, r.StylesGeneric)
+	assert.Equal(t, []string{
+		".specific-multi { display: none !important; }",
+		".specific-sub { display: none !important; }",
+	}, r.StylesSpecific)
+
+	r = engine.Match("example.com", true, true, true)
+	assert.Equal(t, []string{
+		".generic { display: none !important; }",
+		".disabled-generic { display: none !important; }",
+		".generic-restricted { display: none !important; }",
+	}, r.StylesGeneric)
+	assert.Empty(t, r.StylesSpecific)
+
+	// $generichide
+	r = engine.Match("example.org", true, false, true)
+	assert.Empty(t, r.StylesGeneric)
+	assert.Len(t, r.StylesSpecific, 2)
+
+	// $elemhide
+	r = engine.Match("example.org", false, true, true)
+	assert.Empty(t, r.StylesGeneric)
+	assert.Empty(t, r.StylesSpecific)
+}
+
+func TestCosmeticEngineMatchCSS(t *testing.T) {
+	rulesText := strings.Join([]string{
+		"#$#body { padding: 0; }",
+		"example.org#$#.banner { height: 0; }",
+		"sub.example.org#@$#.banner { height: 0; }",
+	}, "\n")
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	engine := NewCosmeticEngine(ruleStorage)
+	assert.Equal(t, 3, engine.RulesCount)
+
+	r := engine.Match("example.org", true, true, true)
+	assert.Equal(t, []string{"body { padding: 0; }"}, r.StylesGeneric)
+	assert.Equal(t, []string{".banner { height: 0; }"}, r.StylesSpecific)
+
+	r = engine.Match("sub.example.org", true, true, true)
+	assert.Equal(t, []string{"body { padding: 0; }"}, r.StylesGeneric)
+	assert.Empty(t, r.StylesSpecific)
+
+	r = engine.Match("example.org", false, true, true)
+	assert.Empty(t, r.StylesGeneric)
+	assert.Empty(t, r.StylesSpecific)
+}
+
+func TestCosmeticEngineMatchExtCSS(t *testing.T) {
+	rulesText := strings.Join([]string{
+		"##div:has(> .banner)",
+		"##.banner",
+		"example.org#?#div.ad",
+		"example.org#?$#div:contains(ad) { height: 0; }",
+		"sub.example.org#@#div:has(> .banner)",
+	}, "\n")
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	engine := NewCosmeticEngine(ruleStorage)
+
+	r := engine.Match("example.org", true, true, true)
+	assert.Equal(t, []string{".banner { display: none !important; }"}, r.StylesGeneric)
+	assert.Empty(t, r.StylesSpecific)
+	assert.Equal(t, []string{"div:has(> .banner) { display: none !important; }"}, r.StylesGenericExtCSS)
+	assert.Equal(t, []string{
+		"div.ad { display: none !important; }",
+		"div:contains(ad) { height: 0; }",
+	}, r.StylesSpecificExtCSS)
+
+	r = engine.Match("sub.example.org", true, true, true)
+	assert.Equal(t, []string{".banner { display: none !important; }"}, r.StylesGeneric)
+	assert.Empty(t, r.StylesGenericExtCSS)
+	assert.Len(t, r.StylesSpecificExtCSS, 2)
+}
+
+func TestCosmeticEngineMatchScriptlets(t *testing.T) {
+	rulesText := strings.Join([]string{
+		"#%#//scriptlet('abort-on-property-read', 'alert')",
+		"example.org#%#//scriptlet('set-constant', 'ads', 'false')",
+		"example.org#%#//scriptlet('set-constant', 'banner', 'false')",
+		"sub.example.org#@%#//scriptlet(\"abort-on-property-read\", \"alert\")",
+		"sub.example.org#@%#//scriptlet('set-constant')",
+	}, "\n")
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	engine := NewCosmeticEngine(ruleStorage)
+
+	r := engine.Match("example.org", true, true, true)
+	assert.Equal(t, []string{
+		"//scriptlet('abort-on-property-read', 'alert')",
+		"//scriptlet('set-constant', 'ads', 'false')",
+		"//scriptlet('set-constant', 'banner', 'false')",
+	}, r.Scripts)
+	assert.Len(t, r.Scriptlets, 3)
+	assert.Equal(t, "set-constant", r.Scriptlets[1].Name)
+	assert.Equal(t, []string{"ads", "false"}, r.Scriptlets[1].Args)
+
+	// Exceptions disable scriptlets by name and arguments, or by name only
+	r = engine.Match("sub.example.org", true, true, true)
+	assert.Empty(t, r.Scripts)
+	assert.Empty(t, r.Scriptlets)
+
+	// $jsinject
+	r = engine.Match("example.org", true, true, false)
+	assert.Empty(t, r.Scripts)
+}
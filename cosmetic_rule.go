@@ -2,7 +2,10 @@ package urlfilter
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -32,7 +35,7 @@ const (
 	markerCSS                cosmeticRuleMarker = "#$#"
 	markerCSSException       cosmeticRuleMarker = "#@$#"
 	markerCSSExtCSS          cosmeticRuleMarker = "#?$#"
-	markerCSSExtCSSException cosmeticRuleMarker = "#@?$"
+	markerCSSExtCSSException cosmeticRuleMarker = "#@?$#"
 
 	// https://kb.adguard.com/en/general/how-to-create-your-own-ad-filters#javascript-rules
 	markerJS          cosmeticRuleMarker = "#%#"
@@ -53,6 +56,20 @@ var cosmeticRulesMarkers = []string{
 	string(markerHTML), string(markerHTMLException),
 }
 
+// contains substrings which are not allowed in the CSS rules styles
+// (after the CSS escapes are decoded, so that they cannot be used to hide these substrings)
+var cssForbiddenSubstrings = []string{"url(", "image-set(", "expression", "-moz-binding"}
+
+// contains ExtCSS pseudo-classes and attributes which cannot be used in the native stylesheets
+// https://github.com/AdguardTeam/ExtendedCss#extended-capabilities
+var extCSSPseudoClasses = []string{
+	":has(", ":has-text(", ":contains(", ":-abp-has(", ":-abp-contains(",
+	":matches-css(", ":matches-css-before(", ":matches-css-after(",
+	":-abp-properties(", ":properties(", ":if(", ":if-not(",
+	":xpath(", ":nth-ancestor(", ":upward(", ":remove(",
+	"[-ext-",
+}
+
 // necessary for findRuleMarker function. Initialized in the init() function
 var cosmeticRuleMarkersFirstChars []byte
 
@@ -79,7 +96,8 @@ type CosmeticRule struct {
 	// Content meaning depends on the rule type.
 	// Element hiding: content is just a selector
 	// CSS: content is a selector + style definition
-	// JS: text of the script to be injected
+	// JS: text of the scriptlet call to be injected
+	// HTML: selector of the elements to be removed
 	Content string
 
 	// Whitelist means that this rule is meant to disable rules with the same content on the specified domains
@@ -89,6 +107,12 @@ type CosmeticRule struct {
 	// ExtendedCSS means that this rule is supposed to be applied by the javascript library
 	// https://github.com/AdguardTeam/ExtendedCss
 	ExtendedCSS bool
+
+	// Scriptlet is the parsed scriptlet call (JS rules only)
+	Scriptlet *Scriptlet
+
+	// HTMLSelector is the parsed selector of the HTML filtering rule (HTML rules only)
+	HTMLSelector *HTMLSelector
 }
 
 // NewCosmeticRule parses the rule text and creates a
@@ -118,8 +142,7 @@ func NewCosmeticRule(ruleText string, filterListID int) (*CosmeticRule, error) {
 		return nil, &RuleSyntaxError{msg: "empty rule content", ruleText: ruleText}
 	}
 
-	// TODO: validate content
-	// TODO: detect ExtCSS pseudo-classes
+	// TODO: validate content of ExtCSS, scriptlet and HTML rules, only CSS styles are validated now
 
 	switch cosmeticRuleMarker(m) {
 	case markerElementHiding:
@@ -127,10 +150,80 @@ func NewCosmeticRule(ruleText string, filterListID int) (*CosmeticRule, error) {
 	case markerElementHidingException:
 		f.Type = CosmeticElementHiding
 		f.Whitelist = true
+	case markerCSS:
+		f.Type = CosmeticCSS
+	case markerCSSException:
+		f.Type = CosmeticCSS
+		f.Whitelist = true
+	case markerElementHidingExtCSS:
+		f.Type = CosmeticElementHiding
+		f.ExtendedCSS = true
+	case markerElementHidingExtCSSException:
+		f.Type = CosmeticElementHiding
+		f.Whitelist = true
+		f.ExtendedCSS = true
+	case markerCSSExtCSS:
+		f.Type = CosmeticCSS
+		f.ExtendedCSS = true
+	case markerCSSExtCSSException:
+		f.Type = CosmeticCSS
+		f.Whitelist = true
+		f.ExtendedCSS = true
+	case markerJS:
+		f.Type = CosmeticJS
+	case markerJSException:
+		f.Type = CosmeticJS
+		f.Whitelist = true
+	case markerHTML:
+		f.Type = CosmeticHTML
+	case markerHTMLException:
+		f.Type = CosmeticHTML
+		f.Whitelist = true
 	default:
 		return nil, ErrUnsupportedRule
 	}
 
+	if f.Type == CosmeticJS {
+		if !strings.HasPrefix(f.Content, scriptletMask) {
+			// Only scriptlets are supported, not arbitrary scripts
+			return nil, ErrUnsupportedRule
+		}
+
+		scriptlet, err := parseScriptlet(f.Content)
+		if err != nil {
+			return nil, &RuleSyntaxError{msg: err.Error(), ruleText: ruleText}
+		}
+		f.Scriptlet = scriptlet
+		f.Content = scriptlet.String()
+		return &f, nil
+	}
+
+	if f.Type == CosmeticHTML {
+		selector, err := parseHTMLSelector(f.Content)
+		if err != nil {
+			return nil, &RuleSyntaxError{msg: err.Error(), ruleText: ruleText}
+		}
+		f.HTMLSelector = selector
+		return &f, nil
+	}
+
+	selector := f.Content
+	if f.Type == CosmeticCSS {
+		var style string
+		var err error
+		selector, style, err = parseCSSContent(f.Content)
+		if err != nil {
+			return nil, &RuleSyntaxError{msg: err.Error(), ruleText: ruleText}
+		}
+		f.Content = selector + " { " + style + " }"
+	}
+
+	// Selectors with ExtCSS pseudo-classes cannot be applied natively
+	// even if the rule uses a regular marker
+	if !f.ExtendedCSS && isExtCSSSelector(selector) {
+		f.ExtendedCSS = true
+	}
+
 	return &f, nil
 }
 
@@ -182,6 +275,125 @@ func (f *CosmeticRule) Match(hostname string) bool {
 	return true
 }
 
+// parseCSSContent splits the content of a CSS rule into a selector and a style declaration.
+// For instance, "body { padding: 0; }" is split into "body" and "padding: 0;".
+// It returns an error if the content is invalid or potentially dangerous.
+func parseCSSContent(content string) (selector string, style string, err error) {
+	if !strings.HasSuffix(content, "}") {
+		return "", "", errors.New("style declaration must end with }")
+	}
+
+	startIndex := strings.IndexByte(content, '{')
+	if startIndex == -1 ||
+		strings.IndexByte(content[startIndex+1:], '{') != -1 ||
+		strings.IndexByte(content[:len(content)-1], '}') != -1 {
+		return "", "", errors.New("invalid style declaration")
+	}
+
+	selector = strings.TrimSpace(content[:startIndex])
+	style = strings.TrimSpace(content[startIndex+1 : len(content)-1])
+	if selector == "" || style == "" {
+		return "", "", errors.New("empty selector or style")
+	}
+
+	// Styles can be used to load remote resources or execute scripts,
+	// we should not allow this
+	styleLowerCase := strings.ToLower(unescapeCSS(style))
+	for _, s := range cssForbiddenSubstrings {
+		if strings.Contains(styleLowerCase, s) {
+			return "", "", fmt.Errorf("forbidden style: %s", s)
+		}
+	}
+
+	return selector, style, nil
+}
+
+// unescapeCSS decodes the CSS escape sequences: hex code points (\75 followed by an optional whitespace)
+// and escaped characters (\:)
+// https://www.w3.org/TR/css-syntax-3/#consume-escaped-code-point
+func unescapeCSS(s string) string {
+	if strings.IndexByte(s, '\\') == -1 {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			sb.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		j := i
+		for j < len(s) && j-i < 6 && isHexDigit(s[j]) {
+			j++
+		}
+
+		if j == i {
+			// Not a hex escape, the next character is used as is
+			sb.WriteByte(s[i])
+			continue
+		}
+
+		codePoint, _ := strconv.ParseUint(s[i:j], 16, 32)
+		sb.WriteRune(rune(codePoint))
+		if j < len(s) && (s[j] == ' ' || s[j] == '\t' || s[j] == '\n') {
+			j++
+		}
+		i = j - 1
+	}
+
+	return sb.String()
+}
+
+// isHexDigit checks if the character is a hexadecimal digit
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// isExtCSSSelector checks if the selector contains any of the ExtCSS pseudo-classes.
+// Quoted attribute values are skipped: a[title=":has(x)"] is a regular selector.
+// https://github.com/AdguardTeam/ExtendedCss
+func isExtCSSSelector(selector string) bool {
+	selector = removeQuotedStrings(selector)
+	for _, pseudoClass := range extCSSPseudoClasses {
+		if strings.Contains(selector, pseudoClass) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeQuotedStrings removes the contents of the quoted strings from the selector,
+// the quotes themselves are kept. Escaped quotes (\") do not close the string.
+func removeQuotedStrings(selector string) string {
+	if strings.IndexByte(selector, '"') == -1 && strings.IndexByte(selector, '\'') == -1 {
+		return selector
+	}
+
+	var sb strings.Builder
+	var quote byte
+	for i := 0; i < len(selector); i++ {
+		c := selector[i]
+		switch {
+		case quote == 0:
+			if c == '"' || c == '\'' {
+				quote = c
+			}
+			sb.WriteByte(c)
+		case c == '\\':
+			// Skip the escaped character
+			i++
+		case c == quote:
+			quote = 0
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String()
+}
+
 // isCosmetic checks if this is a cosmetic filtering rule
 func isCosmetic(line string) bool {
 	index, _ := findCosmeticRuleMarker(line)
@@ -56,3 +56,146 @@ func TestCosmeticRuleMatch(t *testing.T) {
 	assert.False(t, f.Match("testexample.org"))
 	assert.False(t, f.Match("sub.example.org"))
 }
+
+func TestNewCosmeticCSSRule(t *testing.T) {
+	f, err := NewCosmeticRule("example.org#$#body {padding: 0;}", 1)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Equal(t, CosmeticCSS, f.Type)
+	assert.False(t, f.Whitelist)
+	assert.Equal(t, "body { padding: 0; }", f.Content)
+	assert.Equal(t, 1, len(f.permittedDomains))
+
+	f, err = NewCosmeticRule("example.org#@$#body { padding: 0; }", 1)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Equal(t, CosmeticCSS, f.Type)
+	assert.True(t, f.Whitelist)
+	assert.Equal(t, "body { padding: 0; }", f.Content)
+
+	// Invalid style declarations
+	_, err = NewCosmeticRule("example.org#$#body", 1)
+	assert.NotNil(t, err)
+	_, err = NewCosmeticRule("example.org#$#body { padding: 0; ", 1)
+	assert.NotNil(t, err)
+	_, err = NewCosmeticRule("example.org#$#body { }", 1)
+	assert.NotNil(t, err)
+	_, err = NewCosmeticRule("example.org#$#{ padding: 0; }", 1)
+	assert.NotNil(t, err)
+	_, err = NewCosmeticRule("example.org#$#body { padding: 0; } div { padding: 0; }", 1)
+	assert.NotNil(t, err)
+
+	// Dangerous styles
+	_, err = NewCosmeticRule("example.org#$#body { background: URL(http://example.org/track); }", 1)
+	assert.NotNil(t, err)
+	_, err = NewCosmeticRule("example.org#$#body { width: expression(alert(1)); }", 1)
+	assert.NotNil(t, err)
+	_, err = NewCosmeticRule("example.org#$#body { background: \\75 rl(http://example.org/track); }", 1)
+	assert.NotNil(t, err)
+	_, err = NewCosmeticRule("example.org#$#body { background: u\\r\\6C(http://example.org/track); }", 1)
+	assert.NotNil(t, err)
+	_, err = NewCosmeticRule("example.org#$#body { width: expression (alert(1)); }", 1)
+	assert.NotNil(t, err)
+
+	// CSS escapes are allowed in selectors and safe styles
+	f, err = NewCosmeticRule("example.org#$#.a\\:b { display: none; }", 1)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Equal(t, ".a\\:b { display: none; }", f.Content)
+	_, err = NewCosmeticRule("example.org#$#[title=\"\\\"\"] { display: none; }", 1)
+	assert.Nil(t, err)
+	_, err = NewCosmeticRule("example.org#$#q::before { content: \"\\201C\"; }", 1)
+	assert.Nil(t, err)
+}
+
+func TestNewCosmeticExtCSSRule(t *testing.T) {
+	f, err := NewCosmeticRule("example.org#?#div:has(> a[target=\"_blank\"])", 1)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Equal(t, CosmeticElementHiding, f.Type)
+	assert.False(t, f.Whitelist)
+	assert.True(t, f.ExtendedCSS)
+	assert.Equal(t, "div:has(> a[target=\"_blank\"])", f.Content)
+
+	f, err = NewCosmeticRule("example.org#@?#div", 1)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Equal(t, CosmeticElementHiding, f.Type)
+	assert.True(t, f.Whitelist)
+	assert.True(t, f.ExtendedCSS)
+
+	f, err = NewCosmeticRule("example.org#?$#div:contains(banner) { height: 0; }", 1)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Equal(t, CosmeticCSS, f.Type)
+	assert.False(t, f.Whitelist)
+	assert.True(t, f.ExtendedCSS)
+	assert.Equal(t, "div:contains(banner) { height: 0; }", f.Content)
+
+	f, err = NewCosmeticRule("example.org#@?$#div:contains(banner) { height: 0; }", 1)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Equal(t, CosmeticCSS, f.Type)
+	assert.True(t, f.Whitelist)
+	assert.True(t, f.ExtendedCSS)
+	assert.Equal(t, "div:contains(banner) { height: 0; }", f.Content)
+}
+
+func TestDetectExtCSSPseudoClasses(t *testing.T) {
+	extCSS := []string{
+		"##div:has(> .banner)",
+		"##div:contains(advertisement)",
+		"##div:-abp-has(.banner)",
+		"##div:matches-css(background-image: /^url/)",
+		"##div:matches-css-before(content: ad)",
+		"##div:xpath(//div[@class=\"banner\"])",
+		"##.banner:nth-ancestor(2)",
+		"##div[-ext-has=\".banner\"]",
+		"#$#div:has(.banner) { height: 0; }",
+		"##a[title=\":has(x)\"]:has(.banner)",
+	}
+	for _, ruleText := range extCSS {
+		f, err := NewCosmeticRule(ruleText, 1)
+		assert.Nil(t, err, ruleText)
+		assert.True(t, f.ExtendedCSS, ruleText)
+	}
+
+	regular := []string{
+		"##div.has",
+		"##div:not(.banner)",
+		"##a[href^=\"http://example.org/contains(\"]:first-child",
+		"#$#div.contains { height: 0; }",
+		"##a[title=\":has(x)\"]",
+		"##a[title='say \\' :contains(x)']",
+	}
+	for _, ruleText := range regular {
+		f, err := NewCosmeticRule(ruleText, 1)
+		assert.Nil(t, err, ruleText)
+		assert.False(t, f.ExtendedCSS, ruleText)
+	}
+}
+
+func TestNewCosmeticScriptletRule(t *testing.T) {
+	f, err := NewCosmeticRule("example.org#%#//scriptlet(\"abort-on-property-read\", \"alert\")", 1)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Equal(t, CosmeticJS, f.Type)
+	assert.False(t, f.Whitelist)
+	assert.Equal(t, "//scriptlet('abort-on-property-read', 'alert')", f.Content)
+	assert.NotNil(t, f.Scriptlet)
+	assert.Equal(t, "abort-on-property-read", f.Scriptlet.Name)
+	assert.Equal(t, []string{"alert"}, f.Scriptlet.Args)
+
+	f, err = NewCosmeticRule("example.org#@%#//scriptlet('abort-on-property-read', 'alert')", 1)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Equal(t, CosmeticJS, f.Type)
+	assert.True(t, f.Whitelist)
+
+	// Arbitrary scripts are not supported
+	_, err = NewCosmeticRule("example.org#%#window.__gaq = undefined;", 1)
+	assert.Equal(t, ErrUnsupportedRule, err)
+
+	_, err = NewCosmeticRule("example.org#%#//scriptlet(abort-on-property-read)", 1)
+	assert.NotNil(t, err)
+}
@@ -1,5 +1,60 @@
 package urlfilter
 
+import "net"
+
+// DNSVerdict is the enumeration of the ways a DNS query can be processed
+type DNSVerdict int
+
+const (
+	// DNSNoMatch means that no rules match the hostname
+	DNSNoMatch DNSVerdict = iota
+	// DNSBlocked means that the hostname is blocked by a network rule
+	// or by host rules with unspecified IP addresses (0.0.0.0 or ::)
+	DNSBlocked
+	// DNSAllowed means that the hostname is unblocked by a whitelist rule
+	DNSAllowed
+	// DNSRewritten means that the answer should be built from the $dnsrewrite rules
+	// or from the host rules IP addresses
+	DNSRewritten
+)
+
+// DNSRequest represents a DNS query with the information about the client that sent it
+type DNSRequest struct {
+	Hostname string // Hostname is the queried hostname
+
+	ClientIP   net.IP   // ClientIP is the IP address of the client. Can be nil if unknown.
+	ClientName string   // ClientName is the name of the client. Can be empty if unknown.
+	ClientTags []string // ClientTags are the tags of the client
+
+	// DNSType is the query type (DNSTypeA, DNSTypeAAAA, etc).
+	// 0 means that the type is unknown, the rules with $dnstype don't match then.
+	DNSType uint16
+}
+
+// DNSResult is the result of matching a hostname against the DNS engine rules
+type DNSResult struct {
+	Verdict DNSVerdict // Verdict defines how the DNS query should be processed
+
+	NetworkRule   *NetworkRule // NetworkRule is the network rule that defines the verdict (blocking or whitelist)
+	WhitelistRule *NetworkRule // WhitelistRule is the highest priority whitelist rule matching the hostname
+
+	HostRulesV4 []*HostRule // HostRulesV4 are the host rules with IPv4 addresses (A answers)
+	HostRulesV6 []*HostRule // HostRulesV6 are the host rules with IPv6 addresses (AAAA answers)
+
+	// DNSRewriteRules are the $dnsrewrite rules that define the answer.
+	// Rules disabled by the $dnsrewrite whitelist rules are not included.
+	DNSRewriteRules []*NetworkRule
+}
+
+// GetDNSRewrites returns all the rewrites that should be applied to the DNS answer
+func (r *DNSResult) GetDNSRewrites() []*DNSRewrite {
+	var rewrites []*DNSRewrite
+	for _, rule := range r.DNSRewriteRules {
+		rewrites = append(rewrites, rule.dnsRewrite)
+	}
+	return rewrites
+}
+
 // DNSEngine combines host rules and network rules and is supposed to quickly find
 // matching rules for hostnames.
 // First, it looks over network rules and returns first rule found.
@@ -9,6 +64,19 @@ type DNSEngine struct {
 	networkEngine *NetworkEngine     // networkEngine is constructed from the network rules
 	lookupTable   map[uint32][]int64 // map for hosts hashes mapped to the list of rule indexes
 	rulesStorage  *RuleStorage
+
+	// wildcardLookupTable maps the hashes of the domains from the wildcard hostnames (*.example.org)
+	// to the list of rule indexes
+	wildcardLookupTable map[uint32][]int64
+
+	// justDomainRules are the host rules converted from the wildcard just domain lines (*.example.org).
+	// The rule storage keeps these lines as network rules. Key is the rule index.
+	justDomainRules map[int64]*HostRule
+
+	// MatchHostSubdomains enables matching subdomains with the host rules,
+	// i.e. "0.0.0.0 tracker.com" also blocks "a.tracker.com".
+	// Rules for the closest parent domain win: a.tracker.com rules have priority over tracker.com ones.
+	MatchHostSubdomains bool
 }
 
 // NewDNSEngine parses the specified filter lists and returns a DNSEngine built from them.
@@ -32,11 +100,15 @@ func NewDNSEngine(s *RuleStorage) *DNSEngine {
 		rulesStorage: s,
 		lookupTable:  make(map[uint32][]int64, hostRulesCount),
 		RulesCount:   0,
+
+		wildcardLookupTable: make(map[uint32][]int64, 0),
+		justDomainRules:     make(map[int64]*HostRule, 0),
 	}
 
 	networkEngine := &NetworkEngine{
 		ruleStorage:          s,
 		domainsLookupTable:   make(map[uint32][]int64, 0),
+		appsLookupTable:      make(map[uint32][]int64, 0),
 		shortcutsLookupTable: make(map[uint32][]int64, networkRulesCount),
 		shortcutsHistogram:   make(map[uint32]int, 0),
 	}
@@ -48,6 +120,12 @@ func NewDNSEngine(s *RuleStorage) *DNSEngine {
 
 		if hostRule, ok := f.(*HostRule); ok {
 			d.addRule(hostRule, idx)
+		} else if networkRule, ok := f.(*NetworkRule); ok && isWildcardJustDomain(networkRule.RuleText) {
+			hostRule, err := NewHostRule(networkRule.RuleText, networkRule.FilterListID)
+			if err == nil {
+				d.justDomainRules[idx] = hostRule
+				d.addRule(hostRule, idx)
+			}
 		} else if networkRule, ok := f.(*NetworkRule); ok {
 			if isHostLevelNetworkRule(networkRule) {
 				networkEngine.addRule(networkRule, idx)
@@ -60,49 +138,203 @@ func NewDNSEngine(s *RuleStorage) *DNSEngine {
 	return &d
 }
 
-// Match finds a matching rule for the specified hostname.
-// It returns true and the list of rules found or false and nil.
-// The list of rules can be found when there're multiple host rules matching the same domain.
-// For instance:
+// Match finds the rules matching the specified hostname and returns the verdict.
+// $dnsrewrite rules have the highest priority unless the hostname is unblocked by a whitelist rule.
+// Other network rules always have higher priority than the host rules.
+// There can be several host rules matching the same domain, for instance:
 // 192.168.0.1 example.local
 // 2000::1 example.local
-func (d *DNSEngine) Match(hostname string) ([]Rule, bool) {
+func (d *DNSEngine) Match(hostname string) DNSResult {
+	return d.MatchRequest(&DNSRequest{Hostname: hostname})
+}
+
+// MatchRequest finds the rules matching the specified DNS request and returns the verdict.
+// Unlike Match, it takes the client into account so that $client and $ctag rules could be applied.
+// If the query type is known, $dnsrewrite and host rules answering other types are not returned.
+func (d *DNSEngine) MatchRequest(dReq *DNSRequest) DNSResult {
+	result := DNSResult{}
+	hostname := dReq.Hostname
 	if hostname == "" {
-		return nil, false
+		return result
 	}
 
 	r := NewRequestForHostname(hostname)
-	networkRule, ok := d.networkEngine.Match(r)
-	if ok {
-		// Network rules always have higher priority
-		return []Rule{networkRule}, true
+	r.ClientIP = dReq.ClientIP
+	r.ClientName = dReq.ClientName
+	r.ClientTags = dReq.ClientTags
+	r.DNSType = dReq.DNSType
+	var dnsRewriteRules []*NetworkRule
+	for _, rule := range d.networkEngine.MatchAll(r) {
+		if rule.IsOptionEnabled(OptionDNSRewrite) {
+			dnsRewriteRules = append(dnsRewriteRules, rule)
+			continue
+		}
+
+		if result.NetworkRule == nil || rule.isHigherPriority(result.NetworkRule) {
+			result.NetworkRule = rule
+		}
+
+		if rule.Whitelist && (result.WhitelistRule == nil || rule.isHigherPriority(result.WhitelistRule)) {
+			result.WhitelistRule = rule
+		}
+	}
+
+	if result.NetworkRule != nil && result.NetworkRule.Whitelist {
+		result.Verdict = DNSAllowed
+		return result
+	}
+
+	dnsRewriteRules = filterModifierRules(dnsRewriteRules, (*NetworkRule).getDNSRewriteValue)
+	result.DNSRewriteRules = filterDNSRewriteRulesByType(dnsRewriteRules, dReq.DNSType)
+	if len(result.DNSRewriteRules) > 0 {
+		result.Verdict = DNSRewritten
+		return result
+	}
+
+	if result.NetworkRule != nil {
+		result.Verdict = DNSBlocked
+		return result
 	}
 
-	return d.matchLookupTable(hostname)
+	d.matchLookupTable(hostname, &result)
+	setHostRulesVerdict(&result, dReq.DNSType)
+	return result
 }
 
-// matchLookupTable looks for matching rules in the d.lookupTable
-func (d *DNSEngine) matchLookupTable(hostname string) ([]Rule, bool) {
-	hash := fastHash(hostname)
-	rulesIndexes, ok := d.lookupTable[hash]
+// filterDNSRewriteRulesByType removes the $dnsrewrite rules with the answers that don't match the query type.
+// Rules without an answer record (response code only) and CNAME rewrites apply to all query types.
+func filterDNSRewriteRulesByType(rules []*NetworkRule, dnsType uint16) []*NetworkRule {
+	if dnsType == 0 {
+		// Unknown query type, keep all the rules
+		return rules
+	}
+
+	var result []*NetworkRule
+	for _, rule := range rules {
+		rrType := rule.dnsRewrite.RRType
+		if rrType == 0 || rrType == DNSTypeCNAME || rrType == dnsType {
+			result = append(result, rule)
+		}
+	}
+
+	return result
+}
+
+// setHostRulesVerdict removes the host rules that don't answer the query type and sets the verdict.
+// The hostname is blocked if the remaining rules have unspecified IP addresses (0.0.0.0 or ::) only,
+// and rewritten if there are other addresses. If no rules remain, the hostname is still blocked
+// when all of the matching rules block it. Otherwise, there is nothing to answer with.
+func setHostRulesVerdict(result *DNSResult, dnsType uint16) {
+	if len(result.HostRulesV4) == 0 && len(result.HostRulesV6) == 0 {
+		return
+	}
+
+	// Blocking host rules block the hostname for all query types
+	blocked := isBlockingHostRules(result.HostRulesV4) && isBlockingHostRules(result.HostRulesV6)
+
+	filterHostRulesByType(result, dnsType)
+	switch {
+	case len(result.HostRulesV4) == 0 && len(result.HostRulesV6) == 0 && !blocked:
+		result.Verdict = DNSNoMatch
+	case isBlockingHostRules(result.HostRulesV4) && isBlockingHostRules(result.HostRulesV6):
+		result.Verdict = DNSBlocked
+	default:
+		result.Verdict = DNSRewritten
+	}
+}
+
+// isBlockingHostRules checks if all the host rules have unspecified IP addresses
+func isBlockingHostRules(rules []*HostRule) bool {
+	for _, rule := range rules {
+		if !rule.IP.IsUnspecified() {
+			return false
+		}
+	}
+	return true
+}
+
+// filterHostRulesByType removes the host rules that don't answer the query type.
+// A queries get IPv4 addresses only, AAAA queries get IPv6 addresses only.
+// Host rules don't have answers for other query types.
+func filterHostRulesByType(result *DNSResult, dnsType uint16) {
+	switch dnsType {
+	case 0:
+		// Unknown query type, keep all the rules
+	case DNSTypeA:
+		result.HostRulesV6 = nil
+	case DNSTypeAAAA:
+		result.HostRulesV4 = nil
+	default:
+		result.HostRulesV4 = nil
+		result.HostRulesV6 = nil
+	}
+}
+
+// matchLookupTable looks for matching rules in the lookup tables and adds them to the result.
+// The verdict is set later, after the rules are filtered by the query type.
+// It walks up from the hostname to its parent domains and stops at the first level with matching rules.
+func (d *DNSEngine) matchLookupTable(hostname string, result *DNSResult) {
+	rules := d.matchHostRules(nil, d.lookupTable, hostname, hostname)
+
+	subdomains := getSubdomains(hostname)
+	for i := len(subdomains) - 2; i >= 0 && len(rules) == 0; i-- {
+		parent := subdomains[i]
+		rules = d.matchHostRules(rules, d.wildcardLookupTable, parent, hostname)
+
+		if d.MatchHostSubdomains {
+			rules = d.matchHostRules(rules, d.lookupTable, parent, parent)
+		}
+	}
+
+	for _, rule := range rules {
+		if rule.IP.To4() != nil {
+			result.HostRulesV4 = append(result.HostRulesV4, rule)
+		} else {
+			result.HostRulesV6 = append(result.HostRulesV6, rule)
+		}
+	}
+}
+
+// matchHostRules looks for the rules stored in the lookup table under the key
+// and matching the specified hostname, and appends them to the rules list
+func (d *DNSEngine) matchHostRules(rules []*HostRule, table map[uint32][]int64, key string, hostname string) []*HostRule {
+	rulesIndexes, ok := table[fastHash(key)]
 	if !ok {
-		return nil, false
+		return rules
 	}
 
-	var rules []Rule
 	for _, idx := range rulesIndexes {
-		rule := d.rulesStorage.RetrieveHostRule(idx)
-		if rule != nil && rule.Match(hostname) {
+		rule, ok := d.justDomainRules[idx]
+		if !ok {
+			rule = d.rulesStorage.RetrieveHostRule(idx)
+		}
+		if rule != nil && rule.Match(hostname) && !containsHostRule(rules, rule) {
 			rules = append(rules, rule)
 		}
 	}
 
-	return rules, len(rules) > 0
+	return rules
+}
+
+// containsHostRule checks if the list contains the specified rule
+func containsHostRule(rules []*HostRule, rule *HostRule) bool {
+	for _, r := range rules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
 }
 
 // addRule adds rule to the index
 func (d *DNSEngine) addRule(hostRule *HostRule, storageIdx int64) {
 	for _, hostname := range hostRule.Hostnames {
+		if isWildcardHostname(hostname) {
+			hash := fastHash(hostname[len(maskWildcardHostname):])
+			d.wildcardLookupTable[hash] = append(d.wildcardLookupTable[hash], storageIdx)
+			continue
+		}
+
 		hash := fastHash(hostname)
 		rulesIndexes, _ := d.lookupTable[hash]
 		d.lookupTable[hash] = append(rulesIndexes, storageIdx)
@@ -117,12 +349,21 @@ func isHostLevelNetworkRule(r *NetworkRule) bool {
 		return false
 	}
 
-	if r.permittedRequestTypes != 0 && r.restrictedRequestTypes != 0 {
+	// DNS queries are matched as TypeDNS requests,
+	// rules limited to specific request types never match them
+	if r.permittedRequestTypes != 0 {
+		return false
+	}
+
+	// DNS queries have neither the app nor the HTTP method,
+	// and $header rules need the response headers
+	if len(r.permittedApps) > 0 || len(r.restrictedApps) > 0 ||
+		r.permittedMethods != 0 || r.restrictedMethods != 0 || r.header != nil {
 		return false
 	}
 
-	// The only allowed option is $important
-	if r.enabledOptions != 0 && r.enabledOptions != OptionImportant {
+	// The only allowed options are $important, $badfilter and $dnsrewrite
+	if (r.enabledOptions &^ (OptionImportant | OptionBadfilter | OptionDNSRewrite)) != 0 {
 		return false
 	}
 
@@ -1,6 +1,7 @@
 package urlfilter
 
 import (
+	"net"
 	"runtime/debug"
 	"testing"
 	"time"
@@ -71,7 +72,7 @@ func TestBenchDNSEngine(t *testing.T) {
 		}
 
 		startMatch := time.Now()
-		rules, found := dnsEngine.Match(reqHostname)
+		res := dnsEngine.Match(reqHostname)
 		elapsedMatch := time.Since(startMatch)
 		totalElapsed += elapsedMatch
 		if elapsedMatch > maxElapsedMatch {
@@ -81,15 +82,8 @@ func TestBenchDNSEngine(t *testing.T) {
 			minElapsedMatch = elapsedMatch
 		}
 
-		if found {
-			switch v := rules[0].(type) {
-			case *HostRule:
-				totalMatches++
-			case *NetworkRule:
-				if !v.Whitelist {
-					totalMatches++
-				}
-			}
+		if res.Verdict == DNSBlocked || res.Verdict == DNSRewritten {
+			totalMatches++
 		}
 	}
 
@@ -105,27 +99,33 @@ func TestBenchDNSEngine(t *testing.T) {
 }
 
 func TestDNSEngineMatchHostname(t *testing.T) {
-	rulesText := "||example.org^\n0.0.0.0 example.com"
+	rulesText := "||example.org^\n0.0.0.0 example.com\n1.2.3.4 example.net"
 	ruleStorage := newTestRuleStorage(t, 1, rulesText)
 	dnsEngine := NewDNSEngine(ruleStorage)
 	assert.NotNil(t, dnsEngine)
 
-	r, ok := dnsEngine.Match("example.org")
-	assert.True(t, ok)
-	assert.True(t, len(r) == 1)
+	res := dnsEngine.Match("example.org")
+	assert.Equal(t, DNSBlocked, res.Verdict)
+	assert.NotNil(t, res.NetworkRule)
+	assert.Nil(t, res.WhitelistRule)
+	assert.Empty(t, res.HostRulesV4)
 
-	_, ok = r[0].(*NetworkRule)
-	assert.True(t, ok)
+	res = dnsEngine.Match("example.com")
+	assert.Equal(t, DNSBlocked, res.Verdict)
+	assert.Nil(t, res.NetworkRule)
+	assert.Len(t, res.HostRulesV4, 1)
 
-	r, ok = dnsEngine.Match("example.com")
-	assert.True(t, ok)
-	assert.True(t, len(r) == 1)
+	res = dnsEngine.Match("example.net")
+	assert.Equal(t, DNSRewritten, res.Verdict)
+	assert.Len(t, res.HostRulesV4, 1)
+	assert.Equal(t, "1.2.3.4", res.HostRulesV4[0].IP.String())
 
-	_, ok = r[0].(*HostRule)
-	assert.True(t, ok)
+	res = dnsEngine.Match("example.info")
+	assert.Equal(t, DNSNoMatch, res.Verdict)
+	assert.Nil(t, res.NetworkRule)
 
-	_, ok = dnsEngine.Match("example.net")
-	assert.False(t, ok)
+	res = dnsEngine.Match("")
+	assert.Equal(t, DNSNoMatch, res.Verdict)
 }
 
 func TestDNSEngineMatchIP6(t *testing.T) {
@@ -134,9 +134,30 @@ func TestDNSEngineMatchIP6(t *testing.T) {
 	dnsEngine := NewDNSEngine(ruleStorage)
 	assert.NotNil(t, dnsEngine)
 
-	r, ok := dnsEngine.Match("example.org")
-	assert.True(t, ok)
-	assert.True(t, len(r) == 2)
+	res := dnsEngine.Match("example.org")
+	assert.Equal(t, DNSRewritten, res.Verdict)
+	assert.Len(t, res.HostRulesV4, 1)
+	assert.Len(t, res.HostRulesV6, 1)
+	assert.Equal(t, "2000::", res.HostRulesV6[0].IP.String())
+}
+
+func TestDNSEngineMatchWhitelist(t *testing.T) {
+	rulesText := "||example.org^\n@@||example.org^\n||example.com^$important\n@@||example.com^\n0.0.0.0 example.org"
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	dnsEngine := NewDNSEngine(ruleStorage)
+
+	res := dnsEngine.Match("example.org")
+	assert.Equal(t, DNSAllowed, res.Verdict)
+	assert.Equal(t, "@@||example.org^", res.NetworkRule.Text())
+	assert.Equal(t, res.NetworkRule, res.WhitelistRule)
+	assert.Empty(t, res.HostRulesV4)
+
+	// $important rule wins, but the whitelist rule is still reported
+	res = dnsEngine.Match("example.com")
+	assert.Equal(t, DNSBlocked, res.Verdict)
+	assert.Equal(t, "||example.com^$important", res.NetworkRule.Text())
+	assert.NotNil(t, res.WhitelistRule)
+	assert.Equal(t, "@@||example.com^", res.WhitelistRule.Text())
 }
 
 func TestRegexp(t *testing.T) {
@@ -144,14 +165,301 @@ func TestRegexp(t *testing.T) {
 	ruleStorage := newTestRuleStorage(t, 1, text)
 	dnsEngine := NewDNSEngine(ruleStorage)
 
-	rules, ok := dnsEngine.Match("stats.test.com")
-	assert.True(t, ok && rules[0].Text() == text)
+	res := dnsEngine.Match("stats.test.com")
+	assert.Equal(t, DNSBlocked, res.Verdict)
+	assert.Equal(t, text, res.NetworkRule.Text())
 
 	text = "@@/^stats?\\./"
 	ruleStorage = newTestRuleStorage(t, 1, "||stats.test.com^\n"+text)
 	dnsEngine = NewDNSEngine(ruleStorage)
 
-	rules, ok = dnsEngine.Match("stats.test.com")
-	nr := rules[0].(*NetworkRule)
-	assert.True(t, ok && rules[0].Text() == text && nr.Whitelist)
+	res = dnsEngine.Match("stats.test.com")
+	assert.Equal(t, DNSAllowed, res.Verdict)
+	assert.Equal(t, text, res.NetworkRule.Text())
+	assert.True(t, res.NetworkRule.Whitelist)
+}
+
+func TestDNSEngineRequestTypes(t *testing.T) {
+	rulesText := "||example.org^$script\n||example.org^$subdocument,important\n||example.com^$~script"
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	dnsEngine := NewDNSEngine(ruleStorage)
+
+	// Rules limited to specific request types are not loaded
+	assert.Equal(t, 1, dnsEngine.RulesCount)
+
+	res := dnsEngine.Match("example.org")
+	assert.Equal(t, DNSNoMatch, res.Verdict)
+
+	res = dnsEngine.Match("example.com")
+	assert.Equal(t, DNSBlocked, res.Verdict)
+}
+
+func TestDNSEngineAppMethodHeaderRules(t *testing.T) {
+	rulesText := "||example.org^$app=test.exe\n||example.org^$app=~test.exe\n" +
+		"||example.org^$method=get\n||example.org^$method=~post\n" +
+		"||example.org^$header=set-cookie\n||example.com^"
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	dnsEngine := NewDNSEngine(ruleStorage)
+
+	// Rules that can never match a DNS query are not loaded
+	assert.Equal(t, 1, dnsEngine.RulesCount)
+
+	res := dnsEngine.Match("example.org")
+	assert.Equal(t, DNSNoMatch, res.Verdict)
+
+	res = dnsEngine.Match("example.com")
+	assert.Equal(t, DNSBlocked, res.Verdict)
+}
+
+func TestDNSEngineMatchBadfilter(t *testing.T) {
+	rulesText := "||example.org^\n||example.org^$badfilter"
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	dnsEngine := NewDNSEngine(ruleStorage)
+
+	res := dnsEngine.Match("example.org")
+	assert.Equal(t, DNSNoMatch, res.Verdict)
+}
+
+func TestDNSEngineMatchDNSRewrite(t *testing.T) {
+	rulesText := `||example.org^
+||example.org^$dnsrewrite=1.2.3.4
+||example.org^$dnsrewrite=NOERROR;AAAA;2000::1
+||sub.example.org^$dnsrewrite=REFUSED
+@@||sub.example.org^$dnsrewrite=1.2.3.4
+||example.com^$dnsrewrite=other.org
+@@||example.com^$dnsrewrite
+||example.net^$dnsrewrite=1.2.3.4
+@@||example.net^
+1.1.1.1 example.info
+||example.info^$dnsrewrite=NOERROR;A;2.2.2.2`
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	dnsEngine := NewDNSEngine(ruleStorage)
+
+	// $dnsrewrite rules have priority over blocking rules
+	res := dnsEngine.Match("example.org")
+	assert.Equal(t, DNSRewritten, res.Verdict)
+	assert.Len(t, res.DNSRewriteRules, 2)
+	rewrites := res.GetDNSRewrites()
+	assert.Len(t, rewrites, 2)
+	assert.Equal(t, DNSTypeA, rewrites[0].RRType)
+	assert.Equal(t, "1.2.3.4", rewrites[0].Value)
+	assert.Equal(t, DNSTypeAAAA, rewrites[1].RRType)
+
+	// Whitelist rule cancels the rewrite with the same value only
+	res = dnsEngine.Match("sub.example.org")
+	assert.Equal(t, DNSRewritten, res.Verdict)
+	rewrites = res.GetDNSRewrites()
+	assert.Len(t, rewrites, 2)
+	assert.Equal(t, DNSRCodeRefused, rewrites[0].RCode)
+
+	// Whitelist rule without a value cancels all of them
+	res = dnsEngine.Match("example.com")
+	assert.Equal(t, DNSNoMatch, res.Verdict)
+	assert.Empty(t, res.DNSRewriteRules)
+
+	// Regular whitelist rules unblock the hostname
+	res = dnsEngine.Match("example.net")
+	assert.Equal(t, DNSAllowed, res.Verdict)
+	assert.Empty(t, res.DNSRewriteRules)
+
+	// $dnsrewrite rules have priority over host rules
+	res = dnsEngine.Match("example.info")
+	assert.Equal(t, DNSRewritten, res.Verdict)
+	assert.Len(t, res.DNSRewriteRules, 1)
+	assert.Empty(t, res.HostRulesV4)
+}
+
+func TestDNSEngineMatchClient(t *testing.T) {
+	rulesText := `||ads.org^$client=192.168.1.0/24|'Kids tablet'
+||example.org^$ctag=device_phone|~user_child
+@@||example.org^$ctag=user_admin`
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	dnsEngine := NewDNSEngine(ruleStorage)
+
+	res := dnsEngine.Match("ads.org")
+	assert.Equal(t, DNSNoMatch, res.Verdict)
+
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "ads.org", ClientIP: net.ParseIP("192.168.1.10")})
+	assert.Equal(t, DNSBlocked, res.Verdict)
+
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "ads.org", ClientIP: net.ParseIP("10.0.0.1"), ClientName: "Kids tablet"})
+	assert.Equal(t, DNSBlocked, res.Verdict)
+
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "ads.org", ClientIP: net.ParseIP("10.0.0.1")})
+	assert.Equal(t, DNSNoMatch, res.Verdict)
+
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "example.org", ClientTags: []string{"device_phone"}})
+	assert.Equal(t, DNSBlocked, res.Verdict)
+
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "example.org", ClientTags: []string{"device_phone", "user_child"}})
+	assert.Equal(t, DNSNoMatch, res.Verdict)
+
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "example.org", ClientTags: []string{"device_phone", "user_admin"}})
+	assert.Equal(t, DNSAllowed, res.Verdict)
+}
+
+func TestDNSEngineMatchDNSType(t *testing.T) {
+	rulesText := `||example.org^$dnstype=AAAA
+||example.com^$dnstype=~A
+1.2.3.4 example.net
+2000::1 example.net`
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	dnsEngine := NewDNSEngine(ruleStorage)
+
+	res := dnsEngine.MatchRequest(&DNSRequest{Hostname: "example.org", DNSType: DNSTypeAAAA})
+	assert.Equal(t, DNSBlocked, res.Verdict)
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "example.org", DNSType: DNSTypeA})
+	assert.Equal(t, DNSNoMatch, res.Verdict)
+
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "example.com", DNSType: DNSTypeA})
+	assert.Equal(t, DNSNoMatch, res.Verdict)
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "example.com", DNSType: DNSTypeHTTPS})
+	assert.Equal(t, DNSBlocked, res.Verdict)
+
+	// Host rules answer the matching address family only
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "example.net", DNSType: DNSTypeA})
+	assert.Equal(t, DNSRewritten, res.Verdict)
+	assert.Len(t, res.HostRulesV4, 1)
+	assert.Empty(t, res.HostRulesV6)
+
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "example.net", DNSType: DNSTypeAAAA})
+	assert.Equal(t, DNSRewritten, res.Verdict)
+	assert.Empty(t, res.HostRulesV4)
+	assert.Len(t, res.HostRulesV6, 1)
+
+	// There are no host rules answering MX queries
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "example.net", DNSType: DNSTypeMX})
+	assert.Equal(t, DNSNoMatch, res.Verdict)
+	assert.Empty(t, res.HostRulesV4)
+	assert.Empty(t, res.HostRulesV6)
+
+	res = dnsEngine.Match("example.net")
+	assert.Len(t, res.HostRulesV4, 1)
+	assert.Len(t, res.HostRulesV6, 1)
+}
+
+func TestDNSEngineMatchDNSTypeAnswers(t *testing.T) {
+	rulesText := `||example.org^$dnsrewrite=1.2.3.4
+||example.org^$dnsrewrite=NOERROR;AAAA;2000::1
+||example.com^
+||example.com^$dnsrewrite=NOERROR;AAAA;2000::1
+||cname.example.com^$dnsrewrite=other.org
+0.0.0.0 example.net
+0.0.0.0 mixed.net
+2000::1 mixed.net`
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	dnsEngine := NewDNSEngine(ruleStorage)
+
+	// $dnsrewrite answers are filtered by the record type
+	res := dnsEngine.MatchRequest(&DNSRequest{Hostname: "example.org", DNSType: DNSTypeA})
+	assert.Equal(t, DNSRewritten, res.Verdict)
+	rewrites := res.GetDNSRewrites()
+	assert.Len(t, rewrites, 1)
+	assert.Equal(t, DNSTypeA, rewrites[0].RRType)
+	assert.Equal(t, "1.2.3.4", rewrites[0].Value)
+
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "example.org", DNSType: DNSTypeAAAA})
+	assert.Equal(t, DNSRewritten, res.Verdict)
+	rewrites = res.GetDNSRewrites()
+	assert.Len(t, rewrites, 1)
+	assert.Equal(t, DNSTypeAAAA, rewrites[0].RRType)
+
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "example.org", DNSType: DNSTypeMX})
+	assert.Equal(t, DNSNoMatch, res.Verdict)
+	assert.Empty(t, res.DNSRewriteRules)
+
+	res = dnsEngine.Match("example.org")
+	assert.Len(t, res.DNSRewriteRules, 2)
+
+	// Without matching rewrites the other rules define the verdict
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "example.com", DNSType: DNSTypeA})
+	assert.Equal(t, DNSBlocked, res.Verdict)
+	assert.Empty(t, res.DNSRewriteRules)
+
+	// CNAME answers apply to all query types
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "cname.example.com", DNSType: DNSTypeA})
+	assert.Equal(t, DNSRewritten, res.Verdict)
+	assert.Len(t, res.DNSRewriteRules, 1)
+
+	// Blocking host rules block all query types
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "example.net", DNSType: DNSTypeAAAA})
+	assert.Equal(t, DNSBlocked, res.Verdict)
+	assert.Empty(t, res.HostRulesV4)
+
+	// The verdict is defined by the host rules answering the query
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "mixed.net", DNSType: DNSTypeA})
+	assert.Equal(t, DNSBlocked, res.Verdict)
+	assert.Len(t, res.HostRulesV4, 1)
+	assert.Empty(t, res.HostRulesV6)
+
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "mixed.net", DNSType: DNSTypeAAAA})
+	assert.Equal(t, DNSRewritten, res.Verdict)
+	assert.Empty(t, res.HostRulesV4)
+	assert.Len(t, res.HostRulesV6, 1)
+
+	res = dnsEngine.MatchRequest(&DNSRequest{Hostname: "mixed.net", DNSType: DNSTypeTXT})
+	assert.Equal(t, DNSNoMatch, res.Verdict)
+}
+
+func TestDNSEngineMatchWildcardHosts(t *testing.T) {
+	rulesText := "0.0.0.0 *.example.org\n1.2.3.4 a.example.org\n0.0.0.0 example.com"
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	dnsEngine := NewDNSEngine(ruleStorage)
+
+	res := dnsEngine.Match("b.example.org")
+	assert.Equal(t, DNSBlocked, res.Verdict)
+	assert.Len(t, res.HostRulesV4, 1)
+	assert.Equal(t, "0.0.0.0 *.example.org", res.HostRulesV4[0].RuleText)
+
+	// Exact hostnames have priority over the wildcards
+	res = dnsEngine.Match("a.example.org")
+	assert.Equal(t, DNSRewritten, res.Verdict)
+	assert.Len(t, res.HostRulesV4, 1)
+	assert.Equal(t, "1.2.3.4", res.HostRulesV4[0].IP.String())
+
+	// The wildcard does not match the domain itself
+	res = dnsEngine.Match("example.org")
+	assert.Equal(t, DNSNoMatch, res.Verdict)
+
+	// Subdomains are not matched unless MatchHostSubdomains is enabled
+	res = dnsEngine.Match("sub.example.com")
+	assert.Equal(t, DNSNoMatch, res.Verdict)
+
+	// Just domain syntax
+	dnsEngine = NewDNSEngine(newTestRuleStorage(t, 1, "*.example.info"))
+	res = dnsEngine.Match("a.example.info")
+	assert.Equal(t, DNSBlocked, res.Verdict)
+	assert.Len(t, res.HostRulesV4, 1)
+	res = dnsEngine.Match("example.info")
+	assert.Equal(t, DNSNoMatch, res.Verdict)
+}
+
+func TestDNSEngineMatchHostSubdomains(t *testing.T) {
+	rulesText := "0.0.0.0 tracker.com\n1.2.3.4 a.tracker.com\n0.0.0.0 *.example.org example.org"
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	dnsEngine := NewDNSEngine(ruleStorage)
+	dnsEngine.MatchHostSubdomains = true
+
+	res := dnsEngine.Match("tracker.com")
+	assert.Equal(t, DNSBlocked, res.Verdict)
+	assert.Len(t, res.HostRulesV4, 1)
+
+	res = dnsEngine.Match("b.tracker.com")
+	assert.Equal(t, DNSBlocked, res.Verdict)
+	assert.Len(t, res.HostRulesV4, 1)
+	assert.Equal(t, "0.0.0.0 tracker.com", res.HostRulesV4[0].RuleText)
+
+	// The closest parent domain wins
+	res = dnsEngine.Match("b.a.tracker.com")
+	assert.Equal(t, DNSRewritten, res.Verdict)
+	assert.Len(t, res.HostRulesV4, 1)
+	assert.Equal(t, "1.2.3.4", res.HostRulesV4[0].IP.String())
+
+	// The rule is matched by both the wildcard and the parent domain, but returned once
+	res = dnsEngine.Match("a.example.org")
+	assert.Equal(t, DNSBlocked, res.Verdict)
+	assert.Len(t, res.HostRulesV4, 1)
+
+	res = dnsEngine.Match("nottracker.com")
+	assert.Equal(t, DNSNoMatch, res.Verdict)
 }
@@ -0,0 +1,177 @@
+package urlfilter
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+)
+
+// DNS response codes (RFC 1035, section 4.1.1) supported by the $dnsrewrite modifier
+const (
+	DNSRCodeNoError  = 0 // NOERROR
+	DNSRCodeFormErr  = 1 // FORMERR
+	DNSRCodeServFail = 2 // SERVFAIL
+	DNSRCodeNXDomain = 3 // NXDOMAIN
+	DNSRCodeNotImp   = 4 // NOTIMP
+	DNSRCodeRefused  = 5 // REFUSED
+)
+
+// DNS resource record types (RFC 1035, section 3.2.2 and later RFCs)
+// supported by the $dnsrewrite and $dnstype modifiers
+const (
+	DNSTypeA     uint16 = 1
+	DNSTypeNS    uint16 = 2
+	DNSTypeCNAME uint16 = 5
+	DNSTypeSOA   uint16 = 6
+	DNSTypePTR   uint16 = 12
+	DNSTypeMX    uint16 = 15
+	DNSTypeTXT   uint16 = 16
+	DNSTypeAAAA  uint16 = 28
+	DNSTypeSRV   uint16 = 33
+	DNSTypeSVCB  uint16 = 64
+	DNSTypeHTTPS uint16 = 65
+	DNSTypeANY   uint16 = 255
+)
+
+var dnsRCodes = map[string]int{
+	"NOERROR":  DNSRCodeNoError,
+	"FORMERR":  DNSRCodeFormErr,
+	"SERVFAIL": DNSRCodeServFail,
+	"NXDOMAIN": DNSRCodeNXDomain,
+	"NOTIMP":   DNSRCodeNotImp,
+	"REFUSED":  DNSRCodeRefused,
+}
+
+// dnsRewriteTypes are the record types that can be used in the $dnsrewrite answers
+var dnsRewriteTypes = map[string]uint16{
+	"A":     DNSTypeA,
+	"CNAME": DNSTypeCNAME,
+	"PTR":   DNSTypePTR,
+	"MX":    DNSTypeMX,
+	"TXT":   DNSTypeTXT,
+	"AAAA":  DNSTypeAAAA,
+	"SRV":   DNSTypeSRV,
+	"SVCB":  DNSTypeSVCB,
+	"HTTPS": DNSTypeHTTPS,
+}
+
+// dnsQueryTypes are the query types that can be used in the $dnstype modifier
+var dnsQueryTypes = map[string]uint16{
+	"A":     DNSTypeA,
+	"NS":    DNSTypeNS,
+	"CNAME": DNSTypeCNAME,
+	"SOA":   DNSTypeSOA,
+	"PTR":   DNSTypePTR,
+	"MX":    DNSTypeMX,
+	"TXT":   DNSTypeTXT,
+	"AAAA":  DNSTypeAAAA,
+	"SRV":   DNSTypeSRV,
+	"SVCB":  DNSTypeSVCB,
+	"HTTPS": DNSTypeHTTPS,
+	"ANY":   DNSTypeANY,
+}
+
+// DNSRewrite is the parsed value of the $dnsrewrite modifier.
+// https://github.com/AdguardTeam/AdGuardHome/wiki/Hosts-Blocklists#dnsrewrite
+type DNSRewrite struct {
+	RCode  int    // RCode is the response code
+	RRType uint16 // RRType is the type of the answer record. 0 if the answer is empty.
+	Value  string // Value is the answer record value (IP address, hostname, etc)
+
+	text string // original modifier value
+}
+
+// parseDNSRewrite parses the $dnsrewrite modifier value. Two syntaxes are supported:
+// the short one (1.2.3.4, ::1, other.org, REFUSED) and the full one (NOERROR;CNAME;other.org)
+func parseDNSRewrite(value string) (*DNSRewrite, error) {
+	if value == "" {
+		return nil, fmt.Errorf("empty $dnsrewrite value")
+	}
+
+	if strings.Contains(value, ";") {
+		return parseDNSRewriteFull(value)
+	}
+
+	rw := &DNSRewrite{
+		RCode: DNSRCodeNoError,
+		Value: value,
+		text:  value,
+	}
+
+	if rcode, ok := dnsRCodes[strings.ToUpper(value)]; ok {
+		rw.RCode = rcode
+		rw.Value = ""
+	} else if ip := net.ParseIP(value); ip != nil {
+		if ip.To4() != nil {
+			rw.RRType = DNSTypeA
+		} else {
+			rw.RRType = DNSTypeAAAA
+		}
+	} else if govalidator.IsDNSName(value) {
+		rw.RRType = DNSTypeCNAME
+	} else {
+		return nil, fmt.Errorf("invalid $dnsrewrite value: %s", value)
+	}
+
+	return rw, nil
+}
+
+// parseDNSRewriteFull parses the full $dnsrewrite syntax: RCODE;RRTYPE;VALUE
+func parseDNSRewriteFull(value string) (*DNSRewrite, error) {
+	parts := strings.SplitN(value, ";", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid $dnsrewrite value: %s", value)
+	}
+
+	rcode, ok := dnsRCodes[strings.ToUpper(parts[0])]
+	if !ok {
+		return nil, fmt.Errorf("unknown $dnsrewrite response code: %s", parts[0])
+	}
+
+	rw := &DNSRewrite{
+		RCode: rcode,
+		Value: parts[2],
+		text:  value,
+	}
+
+	if parts[1] == "" {
+		if parts[2] != "" {
+			return nil, fmt.Errorf("$dnsrewrite record type is not specified: %s", value)
+		}
+		return rw, nil
+	}
+
+	if rcode != DNSRCodeNoError {
+		return nil, fmt.Errorf("$dnsrewrite records are allowed with NOERROR only: %s", value)
+	}
+
+	rrType, ok := dnsRewriteTypes[strings.ToUpper(parts[1])]
+	if !ok {
+		return nil, fmt.Errorf("unknown $dnsrewrite record type: %s", parts[1])
+	}
+	rw.RRType = rrType
+
+	if !isValidDNSRewriteValue(rrType, rw.Value) {
+		return nil, fmt.Errorf("invalid $dnsrewrite %s value: %s", parts[1], rw.Value)
+	}
+
+	return rw, nil
+}
+
+// isValidDNSRewriteValue checks if the value is valid for the specified record type
+func isValidDNSRewriteValue(rrType uint16, value string) bool {
+	switch rrType {
+	case DNSTypeA:
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil
+	case DNSTypeAAAA:
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() == nil
+	case DNSTypeCNAME, DNSTypePTR:
+		return govalidator.IsDNSName(strings.TrimSuffix(value, "."))
+	default:
+		return value != ""
+	}
+}
@@ -0,0 +1,74 @@
+package urlfilter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDNSRewrite(t *testing.T) {
+	checkRewrite := func(value string, rcode int, rrType uint16, rrValue string) {
+		rw, err := parseDNSRewrite(value)
+		assert.Nil(t, err, value)
+		if assert.NotNil(t, rw, value) {
+			assert.Equal(t, rcode, rw.RCode, value)
+			assert.Equal(t, rrType, rw.RRType, value)
+			assert.Equal(t, rrValue, rw.Value, value)
+		}
+	}
+
+	// Short syntax
+	checkRewrite("1.2.3.4", DNSRCodeNoError, DNSTypeA, "1.2.3.4")
+	checkRewrite("::1", DNSRCodeNoError, DNSTypeAAAA, "::1")
+	checkRewrite("other.org", DNSRCodeNoError, DNSTypeCNAME, "other.org")
+	checkRewrite("REFUSED", DNSRCodeRefused, 0, "")
+	checkRewrite("nxdomain", DNSRCodeNXDomain, 0, "")
+
+	// Full syntax
+	checkRewrite("NOERROR;CNAME;other.org", DNSRCodeNoError, DNSTypeCNAME, "other.org")
+	checkRewrite("NOERROR;A;1.2.3.4", DNSRCodeNoError, DNSTypeA, "1.2.3.4")
+	checkRewrite("NOERROR;AAAA;2000::1", DNSRCodeNoError, DNSTypeAAAA, "2000::1")
+	checkRewrite("NOERROR;TXT;hello world", DNSRCodeNoError, DNSTypeTXT, "hello world")
+	checkRewrite("NOERROR;MX;10 mail.example.org", DNSRCodeNoError, DNSTypeMX, "10 mail.example.org")
+	checkRewrite("SERVFAIL;;", DNSRCodeServFail, 0, "")
+
+	invalid := []string{
+		"",
+		"not a host",
+		"NOERROR;A",
+		"UNKNOWN;A;1.2.3.4",
+		"NOERROR;UNKNOWN;1.2.3.4",
+		"NOERROR;A;::1",
+		"NOERROR;AAAA;1.2.3.4",
+		"NOERROR;CNAME;not a host",
+		"NOERROR;TXT;",
+		"NOERROR;;1.2.3.4",
+		"REFUSED;A;1.2.3.4",
+	}
+	for _, value := range invalid {
+		_, err := parseDNSRewrite(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestDNSRewriteRule(t *testing.T) {
+	f, err := NewNetworkRule("||example.org^$dnsrewrite=1.2.3.4", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.True(t, f.IsOptionEnabled(OptionDNSRewrite))
+	assert.True(t, isHostLevelNetworkRule(f))
+
+	f, err = NewNetworkRule("@@||example.org^$dnsrewrite", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Nil(t, f.dnsRewrite)
+
+	_, err = NewNetworkRule("||example.org^$dnsrewrite", 0)
+	assert.NotNil(t, err)
+
+	// $dnsrewrite rules do not block web requests
+	f, err = NewNetworkRule("||example.org^$dnsrewrite=REFUSED", 0)
+	assert.Nil(t, err)
+	res := NewMatchingResult([]*NetworkRule{f}, nil)
+	assert.Nil(t, res.GetBasicResult())
+}
@@ -1,20 +1,122 @@
 package urlfilter
 
+import "net/http"
+
 // Engine represents the filtering engine with all the loaded rules
 type Engine struct {
+	ruleStorage    *RuleStorage    // storage with all the rules
+	networkEngine  *NetworkEngine  // networkEngine is constructed from the network rules
+	cosmeticEngine *CosmeticEngine // cosmeticEngine is constructed from the cosmetic rules
+}
+
+// NewEngine creates a filtering engine from the rules in the specified storage
+// It builds both the network and the cosmetic engine on top of it
+func NewEngine(s *RuleStorage) *Engine {
+	return &Engine{
+		ruleStorage:    s,
+		networkEngine:  NewNetworkEngine(s),
+		cosmeticEngine: NewCosmeticEngine(s),
+	}
+}
+
+// Match matches the specified request against the network filtering rules
+// Document-level exceptions are resolved using the rules matching the request's source document
+func (e *Engine) Match(r *Request) MatchingResult {
+	requestRules := e.networkEngine.MatchAll(r)
+	return NewMatchingResult(requestRules, e.matchSourceRules(r))
+}
+
+// MatchResponseHeaders matches the request against the $header rules once its response headers are known.
+// Regular whitelist rules matching the request and document-level exceptions still apply at this stage.
+func (e *Engine) MatchResponseHeaders(r *Request, headers http.Header) MatchingResult {
+	headerRules := e.networkEngine.MatchResponseHeaders(r, headers)
+	if len(headerRules) == 0 {
+		return MatchingResult{}
+	}
+
+	allRules := e.networkEngine.MatchAll(r)
+	requestRules := headerRules
+	for _, rule := range allRules {
+		if rule.Whitelist {
+			requestRules = append(requestRules, rule)
+		}
+	}
+
+	return NewMatchingResult(requestRules, e.matchSourceRules(r))
+}
+
+// matchSourceRules finds the rules matching the source document of the request
+func (e *Engine) matchSourceRules(r *Request) []*NetworkRule {
+	sourceURL := r.SourceURL
+	if sourceURL == "" && r.RequestType == TypeDocument {
+		// The document itself is the source of the request
+		sourceURL = r.URL
+	}
+
+	if sourceURL == "" {
+		return nil
+	}
+
+	return e.networkEngine.MatchAll(newDocumentRequest(sourceURL))
+}
+
+// newDocumentRequest creates a request for the document with the specified URL.
+// The document is its own source, so that the rules with $domain match it.
+func newDocumentRequest(url string) *Request {
+	return NewRequest(url, url, TypeDocument)
+}
+
+// GetCosmeticResult builds scripts and styles that need to be injected into the page with the specified URL.
+// Document-level whitelist rules ($elemhide, $generichide, $jsinject) matching the page
+// define which types of cosmetic rules are applied.
+func (e *Engine) GetCosmeticResult(url string) *CosmeticResult {
+	r := newDocumentRequest(url)
+	rules := e.networkEngine.MatchAll(r)
+	includeCSS, includeGenericCSS, includeJS := getCosmeticOptions(rules)
+	return e.cosmeticEngine.Match(r.Hostname, includeCSS, includeGenericCSS, includeJS)
 }
 
-// NewEngine parses the filtering rules and creates a filtering engine of them
-func NewEngine(rules string) (*Engine, error) {
-	if rules == "" {
-		// Empty engine
-		return nil, nil
+// getCosmeticOptions checks the network rules matching the document
+// and returns the flags that should be passed to the cosmetic engine
+func getCosmeticOptions(rules []*NetworkRule) (includeCSS bool, includeGenericCSS bool, includeJS bool) {
+	includeCSS = true
+	includeGenericCSS = true
+	includeJS = true
+
+	for _, rule := range rules {
+		if !rule.Whitelist {
+			continue
+		}
+
+		if rule.IsOptionEnabled(OptionElemhide) {
+			includeCSS = false
+		}
+		if rule.IsOptionEnabled(OptionGenerichide) {
+			includeGenericCSS = false
+		}
+		if rule.IsOptionEnabled(OptionJsinject) {
+			includeJS = false
+		}
 	}
 
-	return &Engine{}, nil
+	return
 }
 
-// Match matches the specified request and looks for a matching filtering rule
-func (e *Engine) Match(r *Request) (bool, Rule) {
-	return false, nil
+// GetHTMLFilter returns the filter that removes elements from the page with the specified URL.
+// It returns nil if there are no HTML filtering rules for this page,
+// or if they are disabled by a $content whitelist rule.
+func (e *Engine) GetHTMLFilter(url string) *HTMLFilter {
+	r := newDocumentRequest(url)
+	for _, rule := range e.networkEngine.MatchAll(r) {
+		if rule.Whitelist && rule.IsOptionEnabled(OptionContent) {
+			return nil
+		}
+	}
+
+	rules := e.cosmeticEngine.MatchHTML(r.Hostname)
+	if len(rules) == 0 {
+		return nil
+	}
+
+	return NewHTMLFilter(rules)
 }
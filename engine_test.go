@@ -0,0 +1,180 @@
+package urlfilter
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngineMatch(t *testing.T) {
+	r1 := "||example.org^"
+	r2 := "@@||example.org/allowed^"
+	r3 := "example.org##banner"
+	rulesText := strings.Join([]string{r1, r2, r3}, "\n")
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	engine := NewEngine(ruleStorage)
+	assert.Equal(t, 2, engine.networkEngine.RulesCount)
+	assert.Equal(t, 1, engine.cosmeticEngine.RulesCount)
+
+	r := NewRequest("http://example.org/", "", TypeOther)
+	res := engine.Match(r)
+	rule := res.GetBasicResult()
+	assert.NotNil(t, rule)
+	assert.Equal(t, r1, rule.String())
+
+	r = NewRequest("http://example.org/allowed/", "", TypeOther)
+	res = engine.Match(r)
+	rule = res.GetBasicResult()
+	assert.NotNil(t, rule)
+	assert.Equal(t, r2, rule.String())
+
+	r = NewRequest("http://example.com/", "", TypeOther)
+	res = engine.Match(r)
+	assert.Nil(t, res.GetBasicResult())
+}
+
+func TestEngineMatchDocumentWhitelist(t *testing.T) {
+	r1 := "||ads.example.com^"
+	r2 := "@@||example.org^$document"
+	rulesText := strings.Join([]string{r1, r2}, "\n")
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	engine := NewEngine(ruleStorage)
+
+	r := NewRequest("http://ads.example.com/", "http://example.org/", TypeScript)
+	res := engine.Match(r)
+	assert.Nil(t, res.BasicRule)
+	assert.NotNil(t, res.DocumentRule)
+	rule := res.GetBasicResult()
+	assert.NotNil(t, rule)
+	assert.Equal(t, r2, rule.String())
+
+	r = NewRequest("http://ads.example.com/", "http://example.net/", TypeScript)
+	res = engine.Match(r)
+	rule = res.GetBasicResult()
+	assert.NotNil(t, rule)
+	assert.Equal(t, r1, rule.String())
+}
+
+func TestEngineMatchDocumentWhitelistDomain(t *testing.T) {
+	r1 := "||ads.example.com^"
+	r2 := "||example.com/banner.js$domain=example.net"
+	r3 := "@@||example.org^$document,domain=example.org"
+	r4 := "@@||example.net^$genericblock,domain=example.net"
+	rulesText := strings.Join([]string{r1, r2, r3, r4}, "\n")
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	engine := NewEngine(ruleStorage)
+
+	r := NewRequest("http://ads.example.com/", "http://example.org/", TypeScript)
+	res := engine.Match(r)
+	assert.NotNil(t, res.DocumentRule)
+	rule := res.GetBasicResult()
+	assert.NotNil(t, rule)
+	assert.Equal(t, r3, rule.String())
+
+	// The document itself
+	r = NewRequest("http://example.org/", "", TypeDocument)
+	res = engine.Match(r)
+	assert.NotNil(t, res.DocumentRule)
+	assert.Equal(t, r3, res.DocumentRule.String())
+
+	// $genericblock disables generic rules only
+	r = NewRequest("http://ads.example.com/", "http://example.net/", TypeScript)
+	res = engine.Match(r)
+	assert.NotNil(t, res.DocumentRule)
+	assert.Nil(t, res.GetBasicResult())
+
+	r = NewRequest("http://example.com/banner.js", "http://example.net/", TypeScript)
+	res = engine.Match(r)
+	rule = res.GetBasicResult()
+	assert.NotNil(t, rule)
+	assert.Equal(t, r2, rule.String())
+}
+
+func TestGetCosmeticOptions(t *testing.T) {
+	rulesText := strings.Join([]string{
+		"@@||example.org^$generichide",
+		"@@||example.org^$jsinject",
+		"@@||example.com^$elemhide",
+		"@@||example.net^$document",
+	}, "\n")
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	engine := NewEngine(ruleStorage)
+
+	checkCosmeticOptions := func(url string, css bool, genericCSS bool, js bool) {
+		r := newDocumentRequest(url)
+		includeCSS, includeGenericCSS, includeJS := getCosmeticOptions(engine.networkEngine.MatchAll(r))
+		assert.Equal(t, css, includeCSS, url)
+		assert.Equal(t, genericCSS, includeGenericCSS, url)
+		assert.Equal(t, js, includeJS, url)
+	}
+
+	checkCosmeticOptions("http://example.org/", true, false, false)
+	checkCosmeticOptions("http://example.com/", false, true, true)
+	checkCosmeticOptions("http://example.net/", false, true, false)
+	checkCosmeticOptions("http://example.info/", true, true, true)
+
+	assert.NotNil(t, engine.GetCosmeticResult("http://example.org/"))
+}
+
+func TestEngineGetCosmeticResult(t *testing.T) {
+	rulesText := strings.Join([]string{
+		"##.generic",
+		"example.org##.specific",
+		"example.com##.specific",
+		"@@||example.org^$generichide",
+		"@@||example.com^$elemhide",
+		"@@||example.info^$generichide,domain=example.info",
+	}, "\n")
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	engine := NewEngine(ruleStorage)
+
+	r := engine.GetCosmeticResult("http://example.org/")
+	assert.Empty(t, r.StylesGeneric)
+	assert.Equal(t, []string{".specific { display: none !important; }"}, r.StylesSpecific)
+
+	r = engine.GetCosmeticResult("http://example.com/")
+	assert.Empty(t, r.StylesGeneric)
+	assert.Empty(t, r.StylesSpecific)
+
+	r = engine.GetCosmeticResult("http://example.net/")
+	assert.Equal(t, []string{".generic { display: none !important; }"}, r.StylesGeneric)
+	assert.Empty(t, r.StylesSpecific)
+
+	// Rules restricted to the page domain match the page itself
+	r = engine.GetCosmeticResult("http://example.info/")
+	assert.Empty(t, r.StylesGeneric)
+}
+
+func TestEngineMatchResponseHeaders(t *testing.T) {
+	r1 := "||example.org^$header=server:tracker"
+	r2 := "@@||example.org/allowed^"
+	r3 := "@@||example.com^$document"
+	rulesText := strings.Join([]string{r1, r2, r3}, "\n")
+	engine := NewEngine(newTestRuleStorage(t, -1, rulesText))
+	headers := http.Header{"Server": []string{"tracker"}}
+
+	r := NewRequest("https://example.org/script.js", "", TypeScript)
+	res := engine.Match(r)
+	assert.Nil(t, res.GetBasicResult())
+
+	res = engine.MatchResponseHeaders(r, headers)
+	assert.NotNil(t, res.GetBasicResult())
+	assert.Equal(t, r1, res.GetBasicResult().RuleText)
+
+	res = engine.MatchResponseHeaders(r, http.Header{"Server": []string{"nginx"}})
+	assert.Nil(t, res.GetBasicResult())
+
+	// Regular whitelist rules still apply
+	r = NewRequest("https://example.org/allowed/script.js", "", TypeScript)
+	res = engine.MatchResponseHeaders(r, headers)
+	assert.NotNil(t, res.GetBasicResult())
+	assert.Equal(t, r2, res.GetBasicResult().RuleText)
+
+	// And so do document-level exceptions
+	r = NewRequest("https://example.org/script.js", "https://example.com/", TypeScript)
+	res = engine.MatchResponseHeaders(r, headers)
+	assert.NotNil(t, res.GetBasicResult())
+	assert.Equal(t, r3, res.GetBasicResult().RuleText)
+}
@@ -0,0 +1,77 @@
+package urlfilter
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// headerModifier is the parsed value of the $header modifier: name, name:value or name:/regex/
+// https://kb.adguard.com/en/general/how-to-create-your-own-ad-filters#header-modifier
+type headerModifier struct {
+	text  string         // original modifier value
+	name  string         // canonical header name
+	value string         // header value. If both value and regex are empty, the header just must be present.
+	regex *regexp.Regexp // regular expression matching the header value
+}
+
+// parseHeaderModifier parses the $header modifier value
+func parseHeaderModifier(value string) (*headerModifier, error) {
+	m := &headerModifier{
+		text: value,
+	}
+
+	name := value
+	headerValue := ""
+	if index := strings.IndexByte(value, ':'); index >= 0 {
+		name = value[:index]
+		headerValue = value[index+1:]
+		if headerValue == "" {
+			return nil, fmt.Errorf("empty $header value: %s", value)
+		}
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("empty $header name: %s", value)
+	}
+	m.name = http.CanonicalHeaderKey(name)
+
+	if len(headerValue) > 1 && strings.HasPrefix(headerValue, maskRegexRule) &&
+		strings.HasSuffix(headerValue, maskRegexRule) {
+		re, err := regexp.Compile(headerValue[1 : len(headerValue)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid $header regex: %s", err)
+		}
+		m.regex = re
+	} else {
+		m.value = headerValue
+	}
+
+	return m, nil
+}
+
+// match checks if any of the response headers matches the modifier
+func (m *headerModifier) match(headers http.Header) bool {
+	values, ok := headers[m.name]
+	if !ok {
+		return false
+	}
+
+	if m.regex == nil && m.value == "" {
+		return true
+	}
+
+	for _, v := range values {
+		if m.regex != nil && m.regex.MatchString(v) {
+			return true
+		}
+
+		if m.regex == nil && m.value == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,55 @@
+package urlfilter
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHeaderModifier(t *testing.T) {
+	m, err := parseHeaderModifier("set-cookie:foo")
+	assert.Nil(t, err)
+	assert.Equal(t, "Set-Cookie", m.name)
+	assert.Equal(t, "foo", m.value)
+	assert.True(t, m.match(http.Header{"Set-Cookie": []string{"bar", "foo"}}))
+	assert.False(t, m.match(http.Header{"Set-Cookie": []string{"foo=bar"}}))
+	assert.False(t, m.match(http.Header{}))
+
+	m, err = parseHeaderModifier("server:/^tracker/")
+	assert.Nil(t, err)
+	assert.NotNil(t, m.regex)
+	assert.True(t, m.match(http.Header{"Server": []string{"tracker 1.0"}}))
+	assert.False(t, m.match(http.Header{"Server": []string{"nginx"}}))
+
+	m, err = parseHeaderModifier("x-tracker")
+	assert.Nil(t, err)
+	assert.True(t, m.match(http.Header{"X-Tracker": []string{""}}))
+	assert.False(t, m.match(http.Header{"Server": []string{"nginx"}}))
+
+	_, err = parseHeaderModifier("")
+	assert.NotNil(t, err)
+	_, err = parseHeaderModifier(":value")
+	assert.NotNil(t, err)
+	_, err = parseHeaderModifier("server:")
+	assert.NotNil(t, err)
+	_, err = parseHeaderModifier("server:/(/")
+	assert.NotNil(t, err)
+}
+
+func TestHeaderRule(t *testing.T) {
+	f, err := NewNetworkRule("||example.org^$header=server:tracker", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.True(t, f.IsOptionEnabled(OptionHeader))
+
+	// $header rules don't match at the first stage
+	r := NewRequest("https://example.org/", "", TypeScript)
+	assert.False(t, f.Match(r))
+
+	assert.True(t, f.MatchResponseHeaders(r, http.Header{"Server": []string{"tracker"}}))
+	assert.False(t, f.MatchResponseHeaders(r, http.Header{"Server": []string{"nginx"}}))
+
+	r = NewRequest("https://example.com/", "", TypeScript)
+	assert.False(t, f.MatchResponseHeaders(r, http.Header{"Server": []string{"tracker"}}))
+}
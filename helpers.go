@@ -67,6 +67,43 @@ func getSubdomains(hostname string) []string {
 	return subdomains
 }
 
+// stringArraysEquals checks if arrays contain the same strings (order is not important)
+func stringArraysEquals(l []string, r []string) bool {
+	if len(l) != len(r) {
+		return false
+	}
+
+	for _, s := range l {
+		if !stringArrayContains(r, s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// stringArraysHaveIntersection checks if arrays have at least one common string
+func stringArraysHaveIntersection(l []string, r []string) bool {
+	for _, s := range l {
+		if stringArrayContains(r, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stringArrayContains checks if the array contains the specified string
+func stringArrayContains(arr []string, str string) bool {
+	for _, s := range arr {
+		if s == str {
+			return true
+		}
+	}
+
+	return false
+}
+
 // sort.Interface
 type byLength []string
 
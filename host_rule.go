@@ -7,9 +7,13 @@ import (
 	"github.com/asaskevich/govalidator"
 )
 
+// maskWildcardHostname is the prefix of the hostnames that match all subdomains of a domain
+const maskWildcardHostname = "*."
+
 // HostRule is a structure for simple host-level rules (i.e. /etc/hosts syntax).
 // http://man7.org/linux/man-pages/man5/hosts.5.html
 // It also supports "just domain" syntax. In this case, the IP will be set to 0.0.0.0.
+// Hostnames can be wildcards matching all subdomains (*.example.org).
 type HostRule struct {
 	RuleText     string   // RuleText is the original rule text
 	FilterListID int      // Filter list identifier
@@ -44,10 +48,14 @@ func NewHostRule(ruleText string, filterListID int) (*HostRule, error) {
 					return nil, &RuleSyntaxError{msg: "cannot parse IP", ruleText: ruleText}
 				}
 			} else {
+				// Hostnames in the hosts files are not validated, except for the wildcards
+				if strings.Contains(part, "*") && !isValidHostname(part) {
+					return nil, &RuleSyntaxError{msg: "invalid wildcard hostname", ruleText: ruleText}
+				}
 				hostnames = append(hostnames, part)
 			}
 		}
-	} else if len(parts) == 1 && govalidator.IsDNSName(parts[0]) {
+	} else if len(parts) == 1 && isValidHostname(parts[0]) {
 		hostnames = append(hostnames, parts[0])
 		ip = net.IPv4(0, 0, 0, 0)
 	} else {
@@ -76,6 +84,7 @@ func (f *HostRule) String() string {
 }
 
 // Match checks if this filtering rule matches the specified hostname
+// Wildcard hostnames (*.example.org) match any subdomain of the domain, but not the domain itself
 func (f *HostRule) Match(hostname string) bool {
 	if len(f.Hostnames) == 1 && hostname == f.Hostnames[0] {
 		return true
@@ -85,7 +94,30 @@ func (f *HostRule) Match(hostname string) bool {
 		if h == hostname {
 			return true
 		}
+
+		if isWildcardHostname(h) && strings.HasSuffix(hostname, h[1:]) {
+			return true
+		}
 	}
 
 	return false
 }
+
+// isValidHostname checks if the hostname is a valid DNS name or a wildcard like *.example.org
+func isValidHostname(hostname string) bool {
+	if isWildcardHostname(hostname) {
+		hostname = hostname[len(maskWildcardHostname):]
+	}
+	return govalidator.IsDNSName(hostname)
+}
+
+// isWildcardJustDomain checks if the line is a wildcard hostname in the just domain syntax (*.example.org)
+// Such lines are network rules as well, so the web filtering engines use them too
+func isWildcardJustDomain(line string) bool {
+	return isWildcardHostname(line) && isValidHostname(line)
+}
+
+// isWildcardHostname checks if the hostname is a wildcard like *.example.org
+func isWildcardHostname(hostname string) bool {
+	return len(hostname) > len(maskWildcardHostname) && strings.HasPrefix(hostname, maskWildcardHostname)
+}
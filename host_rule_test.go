@@ -66,6 +66,23 @@ func TestParseHostRuleText(t *testing.T) {
 	assert.Equal(t, net.IPv4(0, 0, 0, 0), rule.IP)
 	assert.Equal(t, 1, len(rule.Hostnames))
 	assert.Equal(t, "www.ruclicks.com", rule.Hostnames[0])
+
+	rule, err = NewHostRule("0.0.0.0 *.example.org", 1)
+	assert.Nil(t, err)
+	assert.NotNil(t, rule)
+	assert.Equal(t, "*.example.org", rule.Hostnames[0])
+
+	rule, err = NewHostRule("*.example.org", 1)
+	assert.Nil(t, err)
+	assert.NotNil(t, rule)
+	assert.Equal(t, net.IPv4(0, 0, 0, 0), rule.IP)
+	assert.Equal(t, []string{"*.example.org"}, rule.Hostnames)
+
+	for _, ruleText := range []string{"*.", "*example.org", "0.0.0.0 *.", "0.0.0.0 a.*.example.org"} {
+		rule, err = NewHostRule(ruleText, 1)
+		assert.NotNil(t, err, ruleText)
+		assert.Nil(t, rule, ruleText)
+	}
 }
 
 func TestHostRuleMatch(t *testing.T) {
@@ -80,4 +97,12 @@ func TestHostRuleMatch(t *testing.T) {
 	assert.Nil(t, err)
 	assert.True(t, rule.Match("www.opensource.org"))
 	assert.False(t, rule.Match("opensource.org"))
+
+	rule, err = NewHostRule("0.0.0.0 *.example.org example.com", 1)
+	assert.Nil(t, err)
+	assert.True(t, rule.Match("a.example.org"))
+	assert.True(t, rule.Match("b.a.example.org"))
+	assert.True(t, rule.Match("example.com"))
+	assert.False(t, rule.Match("example.org"))
+	assert.False(t, rule.Match("anotherexample.org"))
 }
@@ -0,0 +1,456 @@
+package urlfilter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// defaultHTMLMaxLength is the max length of the element's HTML that is used
+// when the $$ rule has "tag-content" or "wildcard" attributes, but no "max-length".
+const defaultHTMLMaxLength = 8192
+
+// special attributes of the HTML filtering rules
+const (
+	htmlAttrTagContent = "tag-content"
+	htmlAttrWildcard   = "wildcard"
+	htmlAttrMaxLength  = "max-length"
+	htmlAttrMinLength  = "min-length"
+)
+
+// HTMLAttribute is an attribute condition of the HTML filtering rule
+type HTMLAttribute struct {
+	Name  string // Name is the attribute name
+	Value string // Value is the substring that the attribute value must contain. Empty means any value.
+}
+
+// HTMLSelector is a parsed content of the HTML filtering rule.
+// For instance, script[tag-content="banner"][max-length="262144"]
+// https://kb.adguard.com/en/general/how-to-create-your-own-ad-filters#html-filtering-rules
+type HTMLSelector struct {
+	TagName    string          // TagName is the name of the element (lower case)
+	Attributes []HTMLAttribute // Attributes that the element must have
+
+	TagContent string // TagContent is the substring that the element's HTML must contain
+	Wildcard   string // Wildcard is the pattern that the element's HTML must match
+	MinLength  int    // MinLength is the min length of the element's HTML
+	MaxLength  int    // MaxLength is the max length of the element's HTML. 0 means default.
+
+	wildcardRegexp *regexp.Regexp // regular expression compiled from Wildcard
+}
+
+// parseHTMLSelector parses the content of the HTML filtering rule
+func parseHTMLSelector(content string) (*HTMLSelector, error) {
+	idx := strings.IndexByte(content, '[')
+	if idx == -1 {
+		idx = len(content)
+	}
+
+	s := HTMLSelector{
+		TagName: strings.ToLower(content[:idx]),
+	}
+	if !isValidTagName(s.TagName) {
+		return nil, fmt.Errorf("invalid tag name: %s", s.TagName)
+	}
+
+	for idx < len(content) {
+		name, value, next, err := parseHTMLAttribute(content, idx)
+		if err != nil {
+			return nil, err
+		}
+		idx = next
+
+		err = s.setAttribute(name, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.MaxLength > 0 && s.MinLength > s.MaxLength {
+		return nil, errors.New("min-length is greater than max-length")
+	}
+
+	return &s, nil
+}
+
+// parseHTMLAttribute parses the attribute condition that starts at the specified index:
+// [name="value"] or [name]. Double quotes inside of the value are escaped with another double quote.
+// It returns the attribute name, value and the index of the next character after the condition.
+func parseHTMLAttribute(content string, idx int) (name string, value string, next int, err error) {
+	if content[idx] != '[' {
+		return "", "", 0, errors.New("attribute condition must start with [")
+	}
+	idx++
+
+	end := strings.IndexAny(content[idx:], "=]")
+	if end == -1 {
+		return "", "", 0, errors.New("unclosed attribute condition")
+	}
+	name = strings.ToLower(content[idx : idx+end])
+	if name == "" {
+		return "", "", 0, errors.New("empty attribute name")
+	}
+	idx += end
+
+	if content[idx] == ']' {
+		return name, "", idx + 1, nil
+	}
+
+	// Skip =
+	idx++
+	if idx >= len(content) || content[idx] != '"' {
+		return "", "", 0, errors.New("attribute value must be quoted")
+	}
+	idx++
+
+	var sb strings.Builder
+	for ; idx < len(content); idx++ {
+		c := content[idx]
+		if c != '"' {
+			sb.WriteByte(c)
+			continue
+		}
+
+		if idx+1 < len(content) && content[idx+1] == '"' {
+			// Escaped double quote
+			sb.WriteByte(c)
+			idx++
+			continue
+		}
+
+		if idx+1 >= len(content) || content[idx+1] != ']' {
+			return "", "", 0, errors.New("attribute condition must end with ]")
+		}
+		return name, sb.String(), idx + 2, nil
+	}
+
+	return "", "", 0, errors.New("unclosed attribute value")
+}
+
+// setAttribute sets a special attribute or adds an attribute condition
+func (s *HTMLSelector) setAttribute(name string, value string) error {
+	var err error
+
+	switch name {
+	case htmlAttrTagContent:
+		s.TagContent = value
+	case htmlAttrWildcard:
+		s.Wildcard = value
+		pattern := strings.Replace(regexp.QuoteMeta(value), "\\*", ".*", -1)
+		s.wildcardRegexp, err = regexp.Compile("(?s)^" + pattern + "$")
+	case htmlAttrMaxLength:
+		s.MaxLength, err = strconv.Atoi(value)
+		if err == nil && s.MaxLength <= 0 {
+			err = errors.New("max-length must be positive")
+		}
+	case htmlAttrMinLength:
+		s.MinLength, err = strconv.Atoi(value)
+		if err == nil && s.MinLength < 0 {
+			err = errors.New("min-length must not be negative")
+		}
+	case "parent-elements", "parent-search-level":
+		return fmt.Errorf("unsupported attribute: %s", name)
+	default:
+		s.Attributes = append(s.Attributes, HTMLAttribute{Name: name, Value: value})
+	}
+
+	return err
+}
+
+// getMaxLength returns the max length of the HTML of elements that can be matched by this selector.
+// 0 means that there's no limit.
+func (s *HTMLSelector) getMaxLength() int {
+	if s.MaxLength > 0 {
+		return s.MaxLength
+	}
+
+	if s.TagContent != "" || s.Wildcard != "" {
+		return defaultHTMLMaxLength
+	}
+
+	return 0
+}
+
+// matchTag checks if the start tag matches the selector's tag name and attributes
+func (s *HTMLSelector) matchTag(tagName string, attrs map[string]string) bool {
+	if s.TagName != tagName {
+		return false
+	}
+
+	for _, attr := range s.Attributes {
+		value, ok := attrs[attr.Name]
+		if !ok || !strings.Contains(value, attr.Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchContent checks if the element's HTML matches the selector's content conditions
+func (s *HTMLSelector) matchContent(content []byte) bool {
+	if len(content) < s.MinLength {
+		return false
+	}
+
+	maxLength := s.getMaxLength()
+	if maxLength > 0 && len(content) > maxLength {
+		return false
+	}
+
+	if s.TagContent != "" && !bytes.Contains(content, []byte(s.TagContent)) {
+		return false
+	}
+
+	if s.wildcardRegexp != nil && !s.wildcardRegexp.Match(content) {
+		return false
+	}
+
+	return true
+}
+
+// isValidTagName checks if the string can be used as an HTML tag name
+func isValidTagName(tagName string) bool {
+	if tagName == "" {
+		return false
+	}
+
+	for i := 0; i < len(tagName); i++ {
+		c := tagName[i]
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// HTMLFilter removes the elements matching HTML filtering rules from the HTML content
+type HTMLFilter struct {
+	selectors []*HTMLSelector
+}
+
+// NewHTMLFilter creates a new HTML filter from the list of HTML filtering rules.
+// Whitelist rules and rules of other types are ignored.
+func NewHTMLFilter(rules []*CosmeticRule) *HTMLFilter {
+	h := HTMLFilter{}
+	for _, rule := range rules {
+		if rule.Type == CosmeticHTML && !rule.Whitelist && rule.HTMLSelector != nil {
+			h.selectors = append(h.selectors, rule.HTMLSelector)
+		}
+	}
+	return &h
+}
+
+// htmlCandidate is an element that matched a selector by its start tag.
+// Its HTML is buffered until the end tag is found, then we decide if it should be removed.
+type htmlCandidate struct {
+	tagName   string
+	depth     int             // depth of the nested elements with the same tag name
+	selectors []*HTMLSelector // selectors that matched the start tag
+	maxLength int             // max length of the HTML that can be matched. 0 means no limit.
+	buffer    bytes.Buffer    // buffered HTML of the element
+
+	// passthrough means that the element cannot be matched anymore (it is too long),
+	// and its content is written directly to the output
+	passthrough bool
+}
+
+// Filter reads HTML from r, removes the matching elements and writes the result to w.
+// The content is processed as a stream, only the elements that can be removed are buffered.
+func (h *HTMLFilter) Filter(w io.Writer, r io.Reader) error {
+	f := htmlFilterState{
+		filter: h,
+		w:      w,
+	}
+
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				return z.Err()
+			}
+
+			// Unclosed elements are kept as is
+			for len(f.stack) > 0 {
+				if err := f.pop(false); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		// Raw may be changed by the next calls, so we need a copy
+		raw := append([]byte(nil), z.Raw()...)
+
+		var err error
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			err = f.processStartTag(z, raw, tt == html.SelfClosingTagToken)
+		case html.EndTagToken:
+			tagName, _ := z.TagName()
+			err = f.processEndTag(string(tagName), raw)
+		default:
+			err = f.write(raw)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// htmlFilterState is the state of the HTML filtering process
+type htmlFilterState struct {
+	filter *HTMLFilter
+	w      io.Writer
+	stack  []*htmlCandidate // currently open candidates
+}
+
+// processStartTag checks if the element is a candidate for removal
+func (f *htmlFilterState) processStartTag(z *html.Tokenizer, raw []byte, selfClosing bool) error {
+	name, hasAttr := z.TagName()
+	tagName := string(name)
+
+	attrs := map[string]string{}
+	for hasAttr {
+		var key, val []byte
+		key, val, hasAttr = z.TagAttr()
+		attrs[string(key)] = string(val)
+	}
+
+	var selectors []*HTMLSelector
+	maxLength := 0
+	limited := true
+	for _, s := range f.filter.selectors {
+		if !s.matchTag(tagName, attrs) {
+			continue
+		}
+
+		selectors = append(selectors, s)
+		l := s.getMaxLength()
+		if l == 0 {
+			limited = false
+		} else if l > maxLength {
+			maxLength = l
+		}
+	}
+
+	if len(selectors) == 0 {
+		if top := f.top(); top != nil && top.tagName == tagName {
+			top.depth++
+		}
+		return f.write(raw)
+	}
+
+	if !limited {
+		maxLength = 0
+	}
+
+	c := &htmlCandidate{
+		tagName:   tagName,
+		selectors: selectors,
+		maxLength: maxLength,
+	}
+	f.stack = append(f.stack, c)
+	err := f.write(raw)
+	if err != nil {
+		return err
+	}
+
+	if selfClosing || isVoidElement(tagName) {
+		return f.pop(true)
+	}
+	return nil
+}
+
+// processEndTag closes the current candidate if the end tag matches it
+func (f *htmlFilterState) processEndTag(tagName string, raw []byte) error {
+	err := f.write(raw)
+	if err != nil {
+		return err
+	}
+
+	top := f.top()
+	if top == nil || top.tagName != tagName {
+		return nil
+	}
+
+	if top.depth > 0 {
+		top.depth--
+		return nil
+	}
+
+	return f.pop(true)
+}
+
+// top returns the innermost open candidate
+func (f *htmlFilterState) top() *htmlCandidate {
+	if len(f.stack) == 0 {
+		return nil
+	}
+	return f.stack[len(f.stack)-1]
+}
+
+// write writes the data to the innermost buffering candidate or to the output
+func (f *htmlFilterState) write(data []byte) error {
+	for i := len(f.stack) - 1; i >= 0; i-- {
+		c := f.stack[i]
+		if c.passthrough {
+			continue
+		}
+
+		c.buffer.Write(data)
+		if c.maxLength > 0 && c.buffer.Len() > c.maxLength {
+			// The element is too long to be matched, stop buffering it
+			c.passthrough = true
+			data = c.buffer.Bytes()
+			c.buffer = bytes.Buffer{}
+			continue
+		}
+		return nil
+	}
+
+	_, err := f.w.Write(data)
+	return err
+}
+
+// pop closes the innermost candidate.
+// If closed is true and the element's HTML matches any of the selectors, the element is removed.
+func (f *htmlFilterState) pop(closed bool) error {
+	c := f.top()
+	f.stack = f.stack[:len(f.stack)-1]
+
+	if c.passthrough {
+		return nil
+	}
+
+	content := c.buffer.Bytes()
+	if closed {
+		for _, s := range c.selectors {
+			if s.matchContent(content) {
+				return nil
+			}
+		}
+	}
+
+	return f.write(content)
+}
+
+// isVoidElement checks if the element cannot have any content
+// https://html.spec.whatwg.org/multipage/syntax.html#void-elements
+func isVoidElement(tagName string) bool {
+	switch tagName {
+	case "area", "base", "br", "col", "embed", "hr", "img", "input",
+		"link", "meta", "param", "source", "track", "wbr":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package urlfilter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHTMLSelector(t *testing.T) {
+	s, err := parseHTMLSelector("script[tag-content=\"banner\"][max-length=\"262144\"]")
+	assert.Nil(t, err)
+	assert.NotNil(t, s)
+	assert.Equal(t, "script", s.TagName)
+	assert.Equal(t, "banner", s.TagContent)
+	assert.Equal(t, 262144, s.MaxLength)
+	assert.Empty(t, s.Attributes)
+
+	s, err = parseHTMLSelector("DIV[id=\"ad\"][data-text=\"say \"\"hi\"\"\"][hidden][min-length=\"10\"][wildcard=\"*ad*\"]")
+	assert.Nil(t, err)
+	assert.NotNil(t, s)
+	assert.Equal(t, "div", s.TagName)
+	assert.Equal(t, []HTMLAttribute{
+		{Name: "id", Value: "ad"},
+		{Name: "data-text", Value: "say \"hi\""},
+		{Name: "hidden", Value: ""},
+	}, s.Attributes)
+	assert.Equal(t, 10, s.MinLength)
+	assert.Equal(t, "*ad*", s.Wildcard)
+	assert.Equal(t, defaultHTMLMaxLength, s.getMaxLength())
+
+	s, err = parseHTMLSelector("iframe")
+	assert.Nil(t, err)
+	assert.NotNil(t, s)
+	assert.Equal(t, "iframe", s.TagName)
+	assert.Equal(t, 0, s.getMaxLength())
+
+	invalid := []string{
+		"",
+		"[id=\"ad\"]",
+		"div id",
+		"div[id=ad]",
+		"div[id=\"ad\"",
+		"div[id=\"ad\"]x",
+		"div[=\"ad\"]",
+		"div[max-length=\"abc\"]",
+		"div[max-length=\"0\"]",
+		"div[min-length=\"10\"][max-length=\"5\"]",
+		"div[parent-elements=\"td,table\"]",
+	}
+	for _, content := range invalid {
+		_, err = parseHTMLSelector(content)
+		assert.NotNil(t, err, content)
+	}
+}
+
+func TestNewCosmeticHTMLRule(t *testing.T) {
+	f, err := NewCosmeticRule("example.org$$script[tag-content=\"banner\"]", 1)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Equal(t, CosmeticHTML, f.Type)
+	assert.False(t, f.Whitelist)
+	assert.NotNil(t, f.HTMLSelector)
+	assert.Equal(t, "script", f.HTMLSelector.TagName)
+
+	f, err = NewCosmeticRule("example.org$@$script[tag-content=\"banner\"]", 1)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Equal(t, CosmeticHTML, f.Type)
+	assert.True(t, f.Whitelist)
+
+	_, err = NewCosmeticRule("example.org$$script[tag-content=banner]", 1)
+	assert.NotNil(t, err)
+}
+
+func filterHTML(t *testing.T, rulesText []string, content string) string {
+	var rules []*CosmeticRule
+	for _, ruleText := range rulesText {
+		f, err := NewCosmeticRule(ruleText, 1)
+		assert.Nil(t, err, ruleText)
+		rules = append(rules, f)
+	}
+
+	var out bytes.Buffer
+	err := NewHTMLFilter(rules).Filter(&out, strings.NewReader(content))
+	assert.Nil(t, err)
+	return out.String()
+}
+
+func TestHTMLFilter(t *testing.T) {
+	content := `<html><head><script>var banner = 1;</script><script src="app.js"></script></head>` +
+		`<body><div id="ad-top"><div>ad</div></div><div id="content"><p>text</p><img src="ad.png" class="ad"></div></body></html>`
+
+	// Nothing is removed, the content is not changed
+	assert.Equal(t, content, filterHTML(t, nil, content))
+	assert.Equal(t, content, filterHTML(t, []string{"$$iframe"}, content))
+
+	// tag-content
+	assert.Equal(t, strings.Replace(content, "<script>var banner = 1;</script>", "", 1),
+		filterHTML(t, []string{"$$script[tag-content=\"banner\"]"}, content))
+
+	// Attributes and nested elements with the same tag name
+	assert.Equal(t, strings.Replace(content, `<div id="ad-top"><div>ad</div></div>`, "", 1),
+		filterHTML(t, []string{"$$div[id=\"ad-\"]"}, content))
+
+	// Void elements
+	assert.Equal(t, strings.Replace(content, `<img src="ad.png" class="ad">`, "", 1),
+		filterHTML(t, []string{"$$img[class=\"ad\"]"}, content))
+
+	// max-length and min-length
+	assert.Equal(t, content, filterHTML(t, []string{"$$script[tag-content=\"banner\"][max-length=\"10\"]"}, content))
+	assert.Equal(t, content, filterHTML(t, []string{"$$script[tag-content=\"banner\"][min-length=\"100\"]"}, content))
+
+	// wildcard
+	assert.Equal(t, strings.Replace(content, `<div id="ad-top"><div>ad</div></div>`, "", 1),
+		filterHTML(t, []string{"$$div[wildcard=\"<div id=*>ad</div>*\"]"}, content))
+
+	// Nested candidates: the outer element is kept, the inner one is removed
+	assert.Equal(t, strings.Replace(content, `<p>text</p>`, "", 1),
+		filterHTML(t, []string{"$$div[id=\"content\"][tag-content=\"banner\"]", "$$p"}, content))
+
+	// Whitelist rules are ignored by the filter itself
+	assert.Equal(t, content, filterHTML(t, []string{"$@$script"}, content))
+
+	// Unclosed elements are kept
+	unclosed := `<div><script>var banner = 1;`
+	assert.Equal(t, unclosed, filterHTML(t, []string{"$$script"}, unclosed))
+}
+
+func TestEngineGetHTMLFilter(t *testing.T) {
+	rulesText := strings.Join([]string{
+		"example.org,example.com,example.info$$script[tag-content=\"banner\"]",
+		"sub.example.org$@$script[tag-content=\"banner\"]",
+		"@@||example.com^$content",
+		"@@||example.info^$content,domain=example.info",
+	}, "\n")
+	ruleStorage := newTestRuleStorage(t, 1, rulesText)
+	engine := NewEngine(ruleStorage)
+
+	h := engine.GetHTMLFilter("http://example.org/")
+	assert.NotNil(t, h)
+
+	var out bytes.Buffer
+	err := h.Filter(&out, strings.NewReader("<p>text</p><script>banner()</script>"))
+	assert.Nil(t, err)
+	assert.Equal(t, "<p>text</p>", out.String())
+
+	assert.Nil(t, engine.GetHTMLFilter("http://sub.example.org/"))
+	assert.Nil(t, engine.GetHTMLFilter("http://example.com/"))
+	assert.Nil(t, engine.GetHTMLFilter("http://example.net/"))
+
+	// Rules restricted to the page domain match the page itself
+	assert.Nil(t, engine.GetHTMLFilter("http://example.info/"))
+}
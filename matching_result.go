@@ -0,0 +1,269 @@
+package urlfilter
+
+// MatchingResult contains all the rules matching a web request
+// and provides methods that define how the web request should be processed
+type MatchingResult struct {
+	// BasicRule is the rule matching the request itself.
+	// It can either block the request or unblock it (a regular whitelist rule).
+	BasicRule *NetworkRule
+
+	// DocumentRule is the document-level whitelist rule matching the request's
+	// source document ($document, $urlblock, $genericblock, $content).
+	// It can disable blocking for every subrequest of that document.
+	DocumentRule *NetworkRule
+
+	// RedirectRule is the $redirect or $redirect-rule rule that defines
+	// the resource that should be served instead of blocking the request
+	RedirectRule *NetworkRule
+
+	// CspRules are the $csp rules that should be applied to the document.
+	// Rules disabled by the $csp whitelist rules are not included.
+	CspRules []*NetworkRule
+
+	// ReplaceRules are the $replace rules that should be applied to the response body.
+	// Rules disabled by the $replace or $content whitelist rules are not included.
+	ReplaceRules []*NetworkRule
+
+	// CookieRules are the $cookie rules that should be applied to the request and response cookies.
+	// Rules disabled by the $cookie whitelist rules are not included.
+	CookieRules []*NetworkRule
+
+	// RemoveParamRules are the $removeparam rules that modify the request URL instead of blocking it.
+	// Rules disabled by the $removeparam whitelist rules are not included.
+	RemoveParamRules []*NetworkRule
+}
+
+// NewMatchingResult creates an instance of MatchingResult and fills it with the rules
+// requestRules -- rules matching the request itself
+// sourceRules -- rules matching the source document of the request
+func NewMatchingResult(requestRules []*NetworkRule, sourceRules []*NetworkRule) MatchingResult {
+	result := MatchingResult{}
+
+	// First of all, find the document-level whitelist rules and check
+	// if blocking rules (generic or all of them) and content modifications are allowed.
+	// Every rule disables its own part, so a $content rule does not hide a $genericblock one.
+	basicAllowed := true
+	genericAllowed := true
+	contentAllowed := true
+	for _, rule := range sourceRules {
+		if !rule.isDocumentWhitelistRule() {
+			continue
+		}
+
+		if result.DocumentRule == nil || isHigherDocumentRulePriority(rule, result.DocumentRule) {
+			result.DocumentRule = rule
+		}
+
+		if rule.IsOptionEnabled(OptionUrlblock) {
+			basicAllowed = false
+		}
+		if rule.IsOptionEnabled(OptionGenericblock) {
+			genericAllowed = false
+		}
+		if rule.IsOptionEnabled(OptionContent) {
+			contentAllowed = false
+		}
+	}
+
+	var redirectRules []*NetworkRule
+	var cspRules []*NetworkRule
+	var replaceRules []*NetworkRule
+	var cookieRules []*NetworkRule
+	var removeParamRules []*NetworkRule
+	for _, rule := range requestRules {
+		if !rule.Whitelist {
+			if !basicAllowed || (!genericAllowed && rule.isGeneric()) {
+				continue
+			}
+		}
+
+		if rule.IsOptionEnabled(OptionDNSRewrite) {
+			// $dnsrewrite rules are applied by the DNS engine only
+			continue
+		}
+
+		if rule.IsOptionEnabled(OptionCsp) {
+			// $csp rules modify the response, they don't block the request
+			cspRules = append(cspRules, rule)
+			continue
+		}
+
+		if rule.IsOptionEnabled(OptionReplace) {
+			replaceRules = append(replaceRules, rule)
+			continue
+		}
+
+		if rule.IsOptionEnabled(OptionCookie) {
+			cookieRules = append(cookieRules, rule)
+			continue
+		}
+
+		if rule.IsOptionEnabled(OptionRemoveParam) {
+			removeParamRules = append(removeParamRules, rule)
+			continue
+		}
+
+		if rule.isRedirectRule() {
+			redirectRules = append(redirectRules, rule)
+
+			// Whitelist redirect rules only disable redirects,
+			// and $redirect-rule does not block the request by itself
+			if rule.Whitelist || rule.IsOptionEnabled(OptionRedirectRule) {
+				continue
+			}
+		}
+
+		if result.BasicRule == nil || rule.isHigherPriority(result.BasicRule) {
+			result.BasicRule = rule
+		}
+	}
+
+	if result.BasicRule != nil && !result.BasicRule.Whitelist {
+		result.RedirectRule = findRedirectRule(redirectRules)
+	}
+
+	result.CspRules = filterModifierRules(cspRules, func(r *NetworkRule) string {
+		return r.csp
+	})
+
+	// $content disables $replace rules as well as HTML filtering
+	if contentAllowed {
+		result.ReplaceRules = filterModifierRules(replaceRules, (*NetworkRule).getReplaceValue)
+	}
+
+	// Exceptions and duplicates are detected by the cookie name, the cookie options do not matter
+	sortCookieRules(cookieRules)
+	result.CookieRules = filterModifierRules(cookieRules, (*NetworkRule).getCookieName)
+	result.RemoveParamRules = filterModifierRules(removeParamRules, (*NetworkRule).getRemoveParamValue)
+	return result
+}
+
+// GetCspDirectives returns all the Content-Security-Policy directives
+// that should be added to the document's response
+func (m *MatchingResult) GetCspDirectives() []string {
+	var directives []string
+	for _, rule := range m.CspRules {
+		directives = append(directives, rule.csp)
+	}
+	return directives
+}
+
+// ApplyReplaceRules applies the $replace rules to the response body
+func (m *MatchingResult) ApplyReplaceRules(body []byte) []byte {
+	return ApplyReplaceRules(m.ReplaceRules, body)
+}
+
+// filterModifierRules removes whitelist rules and the rules disabled by them
+// from the list of rules with a value modifier like $csp or $replace.
+// A whitelist rule disables the rules with the same value, or all of them if the value is empty.
+// Blocking rules with the same value are applied only once.
+func filterModifierRules(rules []*NetworkRule, value func(r *NetworkRule) string) []*NetworkRule {
+	var result []*NetworkRule
+
+	for _, rule := range rules {
+		if rule.Whitelist || isModifierWhitelisted(rule, rules, value) {
+			continue
+		}
+
+		duplicate := false
+		for _, r := range result {
+			if value(r) == value(rule) {
+				duplicate = true
+				break
+			}
+		}
+
+		if !duplicate {
+			result = append(result, rule)
+		}
+	}
+
+	return result
+}
+
+// isModifierWhitelisted checks if the rule is disabled by any of the whitelist rules
+func isModifierWhitelisted(rule *NetworkRule, rules []*NetworkRule, value func(r *NetworkRule) string) bool {
+	for _, r := range rules {
+		if !r.Whitelist || (value(r) != "" && value(r) != value(rule)) {
+			continue
+		}
+
+		if r.isHigherPriority(rule) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetRedirectResource returns the resource that should be served instead of the blocked request.
+// It returns nil if the request should not be redirected.
+func (m *MatchingResult) GetRedirectResource() *RedirectResource {
+	if m.RedirectRule == nil {
+		return nil
+	}
+
+	return GetRedirectResource(m.RedirectRule.redirect)
+}
+
+// findRedirectRule looks for the redirect rule with the highest priority
+// that is not disabled by a whitelist rule ($redirect or $redirect=resource)
+func findRedirectRule(rules []*NetworkRule) *NetworkRule {
+	var result *NetworkRule
+
+	for _, rule := range rules {
+		if rule.Whitelist || isRedirectWhitelisted(rule, rules) {
+			continue
+		}
+
+		if result == nil || rule.isHigherPriority(result) {
+			result = rule
+		}
+	}
+
+	return result
+}
+
+// isRedirectWhitelisted checks if the redirect rule is disabled by any of the whitelist rules
+// ($redirect or $redirect-rule) with a higher priority
+func isRedirectWhitelisted(rule *NetworkRule, rules []*NetworkRule) bool {
+	for _, r := range rules {
+		if !r.Whitelist || (r.redirect != "" && r.redirect != rule.redirect) {
+			continue
+		}
+
+		if r.isHigherPriority(rule) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetBasicResult returns the rule that should be applied to the web request.
+// Possible outcomes are:
+// returns nil -- bypass the request.
+// returns a whitelist rule -- bypass the request.
+// returns a blocking rule -- block the request.
+func (m *MatchingResult) GetBasicResult() *NetworkRule {
+	if m.BasicRule == nil && m.DocumentRule != nil &&
+		m.DocumentRule.IsOptionEnabled(OptionUrlblock) {
+		// The whole document is whitelisted
+		return m.DocumentRule
+	}
+
+	return m.BasicRule
+}
+
+// isHigherDocumentRulePriority checks if the document-level rule "l" has higher
+// priority than the document-level rule "r".
+// $urlblock is preferred over the other document-level modifiers as it disables more.
+func isHigherDocumentRulePriority(l *NetworkRule, r *NetworkRule) bool {
+	lUrlblock := l.IsOptionEnabled(OptionUrlblock)
+	rUrlblock := r.IsOptionEnabled(OptionUrlblock)
+	if lUrlblock != rUrlblock {
+		return lUrlblock
+	}
+
+	return l.isHigherPriority(r)
+}
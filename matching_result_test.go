@@ -0,0 +1,210 @@
+package urlfilter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMatchingResult(t *testing.T) {
+	// Simple blocking rule
+	blockingRule, err := NewNetworkRule("||example.org^", -1)
+	assert.Nil(t, err)
+	res := NewMatchingResult([]*NetworkRule{blockingRule}, nil)
+	assert.Equal(t, blockingRule, res.BasicRule)
+	assert.Nil(t, res.DocumentRule)
+	assert.Equal(t, blockingRule, res.GetBasicResult())
+
+	// Whitelist rule has higher priority
+	whitelistRule, err := NewNetworkRule("@@||example.org^", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{blockingRule, whitelistRule}, nil)
+	assert.Equal(t, whitelistRule, res.GetBasicResult())
+}
+
+func TestMatchingResultDocumentRules(t *testing.T) {
+	blockingRule, err := NewNetworkRule("||example.org^", -1)
+	assert.Nil(t, err)
+	specificBlockingRule, err := NewNetworkRule("||example.org^$domain=example.com", -1)
+	assert.Nil(t, err)
+	requestRules := []*NetworkRule{blockingRule, specificBlockingRule}
+
+	// $document disables all blocking rules
+	documentRule, err := NewNetworkRule("@@||example.com^$document", -1)
+	assert.Nil(t, err)
+	res := NewMatchingResult(requestRules, []*NetworkRule{documentRule})
+	assert.Nil(t, res.BasicRule)
+	assert.Equal(t, documentRule, res.DocumentRule)
+	assert.Equal(t, documentRule, res.GetBasicResult())
+
+	// $urlblock does the same
+	urlblockRule, err := NewNetworkRule("@@||example.com^$urlblock", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult(requestRules, []*NetworkRule{urlblockRule})
+	assert.Equal(t, urlblockRule, res.GetBasicResult())
+
+	// $genericblock disables generic blocking rules only
+	genericblockRule, err := NewNetworkRule("@@||example.com^$genericblock", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult(requestRules, []*NetworkRule{genericblockRule})
+	assert.Equal(t, genericblockRule, res.DocumentRule)
+	assert.Equal(t, specificBlockingRule, res.GetBasicResult())
+
+	// $urlblock wins over $genericblock
+	res = NewMatchingResult(requestRules, []*NetworkRule{genericblockRule, urlblockRule})
+	assert.Equal(t, urlblockRule, res.DocumentRule)
+	assert.Nil(t, res.BasicRule)
+
+	// $genericblock still applies when a higher priority rule has other document-level modifiers
+	contentRule, err := NewNetworkRule("@@||example.com^$content,important", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult(requestRules, []*NetworkRule{genericblockRule, contentRule})
+	assert.Equal(t, contentRule, res.DocumentRule)
+	assert.Equal(t, specificBlockingRule, res.GetBasicResult())
+
+	// Regular whitelist rules are not document-level rules
+	whitelistRule, err := NewNetworkRule("@@||example.com^", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult(requestRules, []*NetworkRule{whitelistRule})
+	assert.Nil(t, res.DocumentRule)
+	assert.NotNil(t, res.GetBasicResult())
+}
+
+func TestMatchingResultRedirect(t *testing.T) {
+	blockingRule, err := NewNetworkRule("||example.org^", -1)
+	assert.Nil(t, err)
+	redirectRule, err := NewNetworkRule("||example.org/script.js$redirect=noopjs", -1)
+	assert.Nil(t, err)
+	redirectRuleRule, err := NewNetworkRule("||example.org/script.js$redirect-rule=noopjs", -1)
+	assert.Nil(t, err)
+
+	// $redirect blocks the request and redirects it
+	res := NewMatchingResult([]*NetworkRule{redirectRule}, nil)
+	assert.Equal(t, redirectRule, res.GetBasicResult())
+	assert.Equal(t, redirectRule, res.RedirectRule)
+	resource := res.GetRedirectResource()
+	assert.NotNil(t, resource)
+	assert.Equal(t, "noopjs", resource.Name)
+
+	// $redirect-rule does nothing by itself
+	res = NewMatchingResult([]*NetworkRule{redirectRuleRule}, nil)
+	assert.Nil(t, res.GetBasicResult())
+	assert.Nil(t, res.GetRedirectResource())
+
+	// ...but redirects if the request is blocked by another rule
+	res = NewMatchingResult([]*NetworkRule{blockingRule, redirectRuleRule}, nil)
+	assert.Equal(t, blockingRule, res.GetBasicResult())
+	assert.Equal(t, redirectRuleRule, res.RedirectRule)
+	assert.NotNil(t, res.GetRedirectResource())
+
+	// Regular whitelist rule unblocks the request
+	whitelistRule, err := NewNetworkRule("@@||example.org^", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{redirectRule, whitelistRule}, nil)
+	assert.Equal(t, whitelistRule, res.GetBasicResult())
+	assert.Nil(t, res.GetRedirectResource())
+
+	// $redirect whitelist rules disable redirects, but not blocking
+	redirectWhitelistRule, err := NewNetworkRule("@@||example.org^$redirect", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{blockingRule, redirectRule, redirectWhitelistRule}, nil)
+	assert.Equal(t, blockingRule, res.GetBasicResult())
+	assert.Nil(t, res.GetRedirectResource())
+
+	redirectWhitelistRule, err = NewNetworkRule("@@||example.org^$redirect=noopcss", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{redirectRule, redirectWhitelistRule}, nil)
+	assert.Equal(t, redirectRule, res.GetBasicResult())
+	assert.NotNil(t, res.GetRedirectResource())
+
+	// $redirect-rule exceptions disable the redirects with the same resource
+	redirectRuleWhitelistRule, err := NewNetworkRule("@@||example.org^$redirect-rule=noopjs", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{blockingRule, redirectRuleRule, redirectRuleWhitelistRule}, nil)
+	assert.Equal(t, blockingRule, res.GetBasicResult())
+	assert.Nil(t, res.GetRedirectResource())
+
+	// Exceptions with a lower priority do not disable $important redirects
+	importantRedirectRule, err := NewNetworkRule("||example.org/script.js$redirect=noopjs,important", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{importantRedirectRule, redirectRuleWhitelistRule}, nil)
+	assert.Equal(t, importantRedirectRule, res.RedirectRule)
+
+	// ...but $important exceptions do
+	importantWhitelistRule, err := NewNetworkRule("@@||example.org^$redirect,important", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{importantRedirectRule, importantWhitelistRule}, nil)
+	assert.Equal(t, importantRedirectRule, res.GetBasicResult())
+	assert.Nil(t, res.GetRedirectResource())
+}
+
+func TestMatchingResultCsp(t *testing.T) {
+	scriptRule, err := NewNetworkRule("||example.org^$csp=script-src 'self'", -1)
+	assert.Nil(t, err)
+	frameRule, err := NewNetworkRule("||example.org^$csp=frame-src 'none'", -1)
+	assert.Nil(t, err)
+	duplicateRule, err := NewNetworkRule("$csp=frame-src 'none',domain=example.org", -1)
+	assert.Nil(t, err)
+
+	// $csp rules do not block the request
+	res := NewMatchingResult([]*NetworkRule{scriptRule, frameRule, duplicateRule}, nil)
+	assert.Nil(t, res.GetBasicResult())
+	assert.Equal(t, []*NetworkRule{scriptRule, frameRule}, res.CspRules)
+	assert.Equal(t, []string{"script-src 'self'", "frame-src 'none'"}, res.GetCspDirectives())
+
+	// Whitelist rule disables the rules with the same directive
+	whitelistRule, err := NewNetworkRule("@@||example.org^$csp=frame-src 'none'", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{scriptRule, frameRule, whitelistRule}, nil)
+	assert.Equal(t, []string{"script-src 'self'"}, res.GetCspDirectives())
+
+	// ...unless they are $important
+	importantRule, err := NewNetworkRule("||example.org^$csp=frame-src 'none',important", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{importantRule, whitelistRule}, nil)
+	assert.Equal(t, []string{"frame-src 'none'"}, res.GetCspDirectives())
+
+	// Whitelist rule without a directive disables all of them
+	whitelistRule, err = NewNetworkRule("@@||example.org^$csp", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{scriptRule, frameRule, whitelistRule}, nil)
+	assert.Empty(t, res.CspRules)
+
+	// $document disables them too
+	documentRule, err := NewNetworkRule("@@||example.org^$document", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{scriptRule, frameRule, documentRule}, []*NetworkRule{documentRule})
+	assert.Empty(t, res.CspRules)
+}
+
+func TestMatchingResultReplace(t *testing.T) {
+	replaceRule, err := NewNetworkRule("||example.org^$replace=/ad/x/g", -1)
+	assert.Nil(t, err)
+	otherRule, err := NewNetworkRule("||example.org^$replace=/banner//", -1)
+	assert.Nil(t, err)
+
+	// $replace rules do not block the request
+	res := NewMatchingResult([]*NetworkRule{replaceRule, otherRule}, nil)
+	assert.Nil(t, res.GetBasicResult())
+	assert.Equal(t, []*NetworkRule{replaceRule, otherRule}, res.ReplaceRules)
+	assert.Equal(t, "x  x", string(res.ApplyReplaceRules([]byte("ad banner ad"))))
+
+	// Whitelist rule disables the rule with the same value
+	whitelistRule, err := NewNetworkRule("@@||example.org^$replace=/banner//", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{replaceRule, otherRule, whitelistRule}, nil)
+	assert.Equal(t, []*NetworkRule{replaceRule}, res.ReplaceRules)
+
+	// Whitelist rule without a value disables all of them
+	whitelistRule, err = NewNetworkRule("@@||example.org^$replace", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{replaceRule, otherRule, whitelistRule}, nil)
+	assert.Empty(t, res.ReplaceRules)
+	assert.Equal(t, "ad", string(res.ApplyReplaceRules([]byte("ad"))))
+
+	// $content disables them too
+	contentRule, err := NewNetworkRule("@@||example.org^$content", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{replaceRule}, []*NetworkRule{contentRule})
+	assert.Empty(t, res.ReplaceRules)
+}
@@ -2,6 +2,7 @@ package urlfilter
 
 import (
 	"math"
+	"net/http"
 	"strings"
 )
 
@@ -18,11 +19,17 @@ type NetworkEngine struct {
 	// Domain lookup table. Key is the domain name hash.
 	domainsLookupTable map[uint32][]int64
 
+	// Apps lookup table for the rules limited to specific applications only. Key is the app name hash.
+	appsLookupTable map[uint32][]int64
+
 	shortcutsLookupTable map[uint32][]int64 // Shortcuts lookup table. Key is the shortcut hash.
 	shortcutsHistogram   map[uint32]int     // Shortcuts histogram helps us choose the best shortcut for the shortcuts lookup table.
 
 	// Rules for which we could not find a shortcut and could not place it to the shortcuts lookup table.
 	otherRules []*NetworkRule
+
+	// $header rules. They are matched separately once the response headers are known.
+	headerRules []*NetworkRule
 }
 
 // NewNetworkEngine builds an instance of the network engine
@@ -30,6 +37,7 @@ func NewNetworkEngine(s *RuleStorage) *NetworkEngine {
 	engine := NetworkEngine{
 		ruleStorage:          s,
 		domainsLookupTable:   map[uint32][]int64{},
+		appsLookupTable:      map[uint32][]int64{},
 		shortcutsLookupTable: map[uint32][]int64{},
 		shortcutsHistogram:   map[uint32]int{},
 	}
@@ -61,16 +69,22 @@ func (n *NetworkEngine) Match(r *Request) (*NetworkRule, bool) {
 	for i := range rules {
 		rule := rules[i]
 
+		// Skip the rules that don't block or allow the request by themselves
+		if rule.isModifyingRule() {
+			continue
+		}
+
 		if resultRule == nil || rule.isHigherPriority(resultRule) {
 			resultRule = rule
 		}
 	}
 
-	return resultRule, true
+	return resultRule, resultRule != nil
 }
 
 // MatchAll finds all rules matching the specified request regardless of the rule types
 // It will find both whitelist and blacklist rules
+// Rules disabled by $badfilter rules are excluded from the result
 func (n *NetworkEngine) MatchAll(r *Request) []*NetworkRule {
 	// First check by shortcuts
 	result := n.matchShortcutsLookupTable(r)
@@ -79,6 +93,10 @@ func (n *NetworkEngine) MatchAll(r *Request) []*NetworkRule {
 		result = append(result, rule)
 	}
 
+	for _, rule := range n.matchAppsLookupTable(r) {
+		result = append(result, rule)
+	}
+
 	// Now check other rules
 	for i := range n.otherRules {
 		rule := n.otherRules[i]
@@ -87,7 +105,21 @@ func (n *NetworkEngine) MatchAll(r *Request) []*NetworkRule {
 		}
 	}
 
-	return result
+	return removeBadfilterRules(result)
+}
+
+// MatchResponseHeaders finds all $header rules matching the specified request and its response headers.
+// Only the rules depending on the response headers are evaluated here,
+// the other rules are matched by MatchAll before the response is received.
+func (n *NetworkEngine) MatchResponseHeaders(r *Request, headers http.Header) []*NetworkRule {
+	var result []*NetworkRule
+	for _, rule := range n.headerRules {
+		if rule.MatchResponseHeaders(r, headers) {
+			result = append(result, rule)
+		}
+	}
+
+	return removeBadfilterRules(result)
 }
 
 // matchShortcutsLookupTable finds all matching rules from the shortcuts lookup table
@@ -133,10 +165,33 @@ func (n *NetworkEngine) matchDomainsLookupTable(r *Request) []*NetworkRule {
 	return result
 }
 
+// matchAppsLookupTable finds all matching rules from the apps lookup table
+func (n *NetworkEngine) matchAppsLookupTable(r *Request) []*NetworkRule {
+	var result []*NetworkRule
+
+	if r.App == "" {
+		return result
+	}
+
+	hash := fastHash(strings.ToLower(r.App))
+	if rules, ok := n.appsLookupTable[hash]; ok {
+		for i := range rules {
+			ruleIdx := rules[i]
+			rule := n.ruleStorage.RetrieveNetworkRule(ruleIdx)
+			if rule != nil && rule.Match(r) {
+				result = append(result, rule)
+			}
+		}
+	}
+	return result
+}
+
 // addRule adds rule to the network engine
 func (n *NetworkEngine) addRule(f *NetworkRule, storageIdx int64) {
-	if !n.addRuleToShortcutsTable(f, storageIdx) {
-		if !n.addRuleToDomainsTable(f, storageIdx) {
+	if f.header != nil {
+		n.headerRules = append(n.headerRules, f)
+	} else if !n.addRuleToShortcutsTable(f, storageIdx) {
+		if !n.addRuleToDomainsTable(f, storageIdx) && !n.addRuleToAppsTable(f, storageIdx) {
 			if !containsRule(n.otherRules, f) {
 				n.otherRules = append(n.otherRules, f)
 			}
@@ -164,6 +219,21 @@ func (n *NetworkEngine) addRuleToDomainsTable(f *NetworkRule, storageIdx int64)
 	return true
 }
 
+// addRuleToAppsTable tries to add the rule to the apps lookup table.
+// returns true if it was added (the rule is limited to specific apps)
+func (n *NetworkEngine) addRuleToAppsTable(f *NetworkRule, storageIdx int64) bool {
+	if len(f.permittedApps) == 0 {
+		return false
+	}
+
+	for _, app := range f.permittedApps {
+		hash := fastHash(app)
+		n.appsLookupTable[hash] = append(n.appsLookupTable[hash], storageIdx)
+	}
+
+	return true
+}
+
 // addRuleToShortcutsTable tries to add the rule to the shortcuts table.
 // returns true if it was added or false if the shortcut is too short
 func (n *NetworkEngine) addRuleToShortcutsTable(f *NetworkRule, storageIdx int64) bool {
@@ -259,6 +329,41 @@ func fastHash(str string) uint32 {
 	return fastHashBetween(str, 0, len(str))
 }
 
+// removeBadfilterRules removes $badfilter rules and the rules disabled by them from the list
+func removeBadfilterRules(rules []*NetworkRule) []*NetworkRule {
+	var badfilterRules []*NetworkRule
+	for _, rule := range rules {
+		if rule.IsOptionEnabled(OptionBadfilter) {
+			badfilterRules = append(badfilterRules, rule)
+		}
+	}
+
+	if len(badfilterRules) == 0 {
+		return rules
+	}
+
+	result := make([]*NetworkRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.IsOptionEnabled(OptionBadfilter) {
+			continue
+		}
+
+		negated := false
+		for _, badfilter := range badfilterRules {
+			if badfilter.negatesBadfilter(rule) {
+				negated = true
+				break
+			}
+		}
+
+		if !negated {
+			result = append(result, rule)
+		}
+	}
+
+	return result
+}
+
 // helper function that checks if the specified rule is already in the array
 func containsRule(rules []*NetworkRule, r *NetworkRule) bool {
 	if rules == nil {
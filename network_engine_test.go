@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime/debug"
@@ -149,6 +150,10 @@ func getRequestType(t string) RequestType {
 		return TypeXmlhttprequest
 	case "websocket":
 		return TypeWebsocket
+	case "ping":
+		return TypePing
+	case "cspviolationreport":
+		return TypeCSPReport
 	default:
 		return TypeOther
 	}
@@ -302,3 +307,156 @@ func getRSS() uint64 {
 	}
 	return minfo.RSS
 }
+
+func TestMatchBadfilterRules(t *testing.T) {
+	list1 := &StringRuleList{
+		ID:        1,
+		RulesText: "||example.org^\n||example.com^$domain=a.com|b.com",
+	}
+	list2 := &StringRuleList{
+		ID:        2,
+		RulesText: "||example.org^$badfilter\n||example.com^$domain=a.com,badfilter",
+	}
+	ruleStorage, err := NewRuleStorage([]RuleList{list1, list2})
+	assert.Nil(t, err)
+	engine := NewNetworkEngine(ruleStorage)
+
+	// The rule is disabled by a $badfilter rule from another list
+	r := NewRequest("http://example.org/", "", TypeOther)
+	rule, ok := engine.Match(r)
+	assert.False(t, ok)
+	assert.Nil(t, rule)
+
+	// The rule is disabled on a.com only
+	r = NewRequest("http://example.com/", "http://a.com/", TypeOther)
+	_, ok = engine.Match(r)
+	assert.False(t, ok)
+
+	r = NewRequest("http://example.com/", "http://b.com/", TypeOther)
+	rule, ok = engine.Match(r)
+	assert.True(t, ok)
+	assert.NotNil(t, rule)
+	assert.Equal(t, "||example.com^$domain=a.com|b.com", rule.String())
+}
+
+func TestMatchDenyAllowRules(t *testing.T) {
+	rulesText := "*$script,domain=a.com|b.com,denyallow=x.com\n||example.org^$denyallow=example.org,domain=c.com"
+	engine := NewNetworkEngine(newTestRuleStorage(t, -1, rulesText))
+
+	r := NewRequest("https://z.com/script.js", "https://sub.a.com/", TypeScript)
+	rule, ok := engine.Match(r)
+	assert.True(t, ok)
+	assert.NotNil(t, rule)
+
+	r = NewRequest("https://cdn.x.com/script.js", "https://sub.a.com/", TypeScript)
+	_, ok = engine.Match(r)
+	assert.False(t, ok)
+
+	r = NewRequest("https://example.org/", "https://c.com/", TypeOther)
+	_, ok = engine.Match(r)
+	assert.False(t, ok)
+}
+
+func TestMatchMethodRules(t *testing.T) {
+	rulesText := "||example.org^$method=post\n@@||example.org/allowed^$method=~put"
+	engine := NewNetworkEngine(newTestRuleStorage(t, -1, rulesText))
+
+	r := NewRequest("https://example.org/beacon", "", TypeXmlhttprequest)
+	r.Method = "POST"
+	rule, ok := engine.Match(r)
+	assert.True(t, ok)
+	assert.False(t, rule.Whitelist)
+
+	r.Method = "GET"
+	_, ok = engine.Match(r)
+	assert.False(t, ok)
+
+	r = NewRequest("https://example.org/allowed", "", TypeXmlhttprequest)
+	r.Method = "POST"
+	rule, ok = engine.Match(r)
+	assert.True(t, ok)
+	assert.True(t, rule.Whitelist)
+}
+
+func TestMatchResponseHeaders(t *testing.T) {
+	rulesText := "||example.org^$header=server:tracker\n||example.org^$header=x-cmp\n||example.org^$header=x-cmp,badfilter"
+	engine := NewNetworkEngine(newTestRuleStorage(t, -1, rulesText))
+	assert.Len(t, engine.headerRules, 3)
+
+	r := NewRequest("https://example.org/", "", TypeScript)
+	_, ok := engine.Match(r)
+	assert.False(t, ok)
+
+	rules := engine.MatchResponseHeaders(r, http.Header{"Server": []string{"tracker"}})
+	assert.Len(t, rules, 1)
+	assert.Equal(t, "||example.org^$header=server:tracker", rules[0].RuleText)
+
+	rules = engine.MatchResponseHeaders(r, http.Header{"X-Cmp": []string{"1"}})
+	assert.Empty(t, rules)
+}
+
+func TestMatchAppRules(t *testing.T) {
+	rulesText := "$app=org.example.app\n@@||example.org^$app=org.example.app\n||example.com^$app=~com.browser"
+	engine := NewNetworkEngine(newTestRuleStorage(t, -1, rulesText))
+	assert.Len(t, engine.appsLookupTable, 1)
+
+	r := NewRequest("https://example.net/", "", TypeOther)
+	r.App = "org.example.app"
+	rule, ok := engine.Match(r)
+	assert.True(t, ok)
+	assert.Equal(t, "$app=org.example.app", rule.RuleText)
+
+	r = NewRequest("https://example.org/", "", TypeOther)
+	r.App = "Org.Example.App"
+	rule, ok = engine.Match(r)
+	assert.True(t, ok)
+	assert.True(t, rule.Whitelist)
+
+	r.App = "com.other.app"
+	_, ok = engine.Match(r)
+	assert.False(t, ok)
+
+	r = NewRequest("https://example.com/", "", TypeOther)
+	r.App = "com.browser"
+	_, ok = engine.Match(r)
+	assert.False(t, ok)
+	r.App = "com.other.app"
+	_, ok = engine.Match(r)
+	assert.True(t, ok)
+}
+
+func TestMatchSkipsModifyingRules(t *testing.T) {
+	rulesText := strings.Join([]string{
+		"$cookie=__utm",
+		"$removeparam=utm_source",
+		"$csp=script-src 'self'",
+		"||example.org^$dnsrewrite=1.2.3.4",
+		"||example.org^$replace=/a/b/",
+		"||example.org^$redirect-rule=noopjs",
+		"@@||example.org^$redirect",
+	}, "\n")
+	engine := NewNetworkEngine(newTestRuleStorage(t, -1, rulesText))
+
+	r := NewRequest("https://example.org/", "", TypeDocument)
+	assert.Len(t, engine.MatchAll(r), 7)
+	rule, ok := engine.Match(r)
+	assert.False(t, ok)
+	assert.Nil(t, rule)
+
+	// The blocking rule is still found
+	engine = NewNetworkEngine(newTestRuleStorage(t, -1, rulesText+"\n||example.org^"))
+	rule, ok = engine.Match(r)
+	assert.True(t, ok)
+	assert.NotNil(t, rule)
+	assert.Equal(t, "||example.org^", rule.String())
+}
+
+func TestMatchWildcardJustDomainRule(t *testing.T) {
+	engine := NewNetworkEngine(newTestRuleStorage(t, -1, "*.example.org"))
+	assert.Equal(t, 1, engine.RulesCount)
+
+	rule, ok := engine.Match(NewRequest("https://sub.example.org/", "", TypeDocument))
+	assert.True(t, ok)
+	assert.NotNil(t, rule)
+	assert.Equal(t, "*.example.org", rule.String())
+}
@@ -2,6 +2,7 @@ package urlfilter
 
 import (
 	"fmt"
+	"net/http"
 	"regexp"
 	"strings"
 	"sync"
@@ -60,6 +61,22 @@ const (
 	OptionReplace // $replace
 	OptionCookie  // $cookie
 
+	// Query parameters removal
+	OptionRemoveParam // $removeparam
+
+	// Response headers matching
+	OptionHeader // $header
+
+	// DNS-level options
+	OptionDNSRewrite // $dnsrewrite
+
+	// New options are appended to the end so that the values of the existing ones don't change
+
+	OptionBadfilter // $badfilter modifier
+
+	OptionRedirect     // $redirect
+	OptionRedirectRule // $redirect-rule
+
 	// Blacklist-only options
 	OptionBlacklistOnly = OptionPopup | OptionEmpty | OptionMp4
 
@@ -69,6 +86,66 @@ const (
 		OptionStealth
 )
 
+// requestMethod is the enumeration of the HTTP methods supported by the $method modifier
+type requestMethod uint
+
+const (
+	methodConnect requestMethod = 1 << iota
+	methodDelete
+	methodGet
+	methodHead
+	methodOptions
+	methodPatch
+	methodPost
+	methodPut
+	methodTrace
+)
+
+// requestMethods maps the lowercase method names to their flags
+var requestMethods = map[string]requestMethod{
+	"connect": methodConnect,
+	"delete":  methodDelete,
+	"get":     methodGet,
+	"head":    methodHead,
+	"options": methodOptions,
+	"patch":   methodPatch,
+	"post":    methodPost,
+	"put":     methodPut,
+	"trace":   methodTrace,
+}
+
+// optionAliases maps the uBlock Origin and Adblock Plus modifiers
+// to their exact equivalents supported by this library
+var optionAliases = map[string]string{
+	"1p":      "first-party",
+	"~1p":     "~first-party",
+	"3p":      "third-party",
+	"~3p":     "~third-party",
+	"doc":     "document",
+	"frame":   "subdocument",
+	"~frame":  "~subdocument",
+	"xhr":     "xmlhttprequest",
+	"~xhr":    "~xmlhttprequest",
+	"css":     "stylesheet",
+	"~css":    "~stylesheet",
+	"ghide":   "generichide",
+	"ehide":   "elemhide",
+	"from":    "domain",
+	"beacon":  "ping",
+	"~beacon": "~ping",
+}
+
+// unsupportedOptions are the uBlock Origin modifiers that do not have exact equivalents
+var unsupportedOptions = map[string]string{
+	"all":      "it includes popups and inline resources that cannot be handled by a single rule",
+	"strict1p": "first-party requests are detected by the domain, not by the hostname",
+	"strict3p": "third-party requests are detected by the domain, not by the hostname",
+	"popunder": "popunders cannot be detected",
+}
+
+// inlineScriptCsp is the Content-Security-Policy directive used by uBlock Origin for $inline-script
+const inlineScriptCsp = "script-src 'unsafe-eval' * blob: data:"
+
 // NetworkRule is a basic filtering rule
 // https://kb.adguard.com/en/general/how-to-create-your-own-ad-filters#basic-rules
 type NetworkRule struct {
@@ -79,6 +156,16 @@ type NetworkRule struct {
 
 	permittedDomains  []string // a list of permitted domains from the $domain modifier
 	restrictedDomains []string // a list of restricted domains from the $domain modifier
+	denyAllowDomains  []string // a list of request domains excluded by the $denyallow modifier
+
+	permittedApps  []string // a list of permitted applications from the $app modifier (lowercase)
+	restrictedApps []string // a list of restricted applications from the $app modifier (lowercase)
+
+	clients    *clientsModifier    // clients from the $client modifier
+	clientTags *clientTagsModifier // client tags from the $ctag modifier
+
+	permittedDNSTypes  []uint16 // a list of permitted DNS query types from the $dnstype modifier
+	restrictedDNSTypes []uint16 // a list of restricted DNS query types from the $dnstype modifier
 
 	enabledOptions  NetworkRuleOption // Flag with all enabled rule options
 	disabledOptions NetworkRuleOption // Flag with all disabled rule options
@@ -86,10 +173,25 @@ type NetworkRule struct {
 	permittedRequestTypes  RequestType // Flag with all permitted request types. 0 means ALL.
 	restrictedRequestTypes RequestType // Flag with all restricted request types. 0 means NONE.
 
+	permittedMethods  requestMethod // Flag with all permitted HTTP methods. 0 means ALL.
+	restrictedMethods requestMethod // Flag with all restricted HTTP methods. 0 means NONE.
+
+	redirect string // name of the resource from the $redirect modifier
+	csp      string // Content-Security-Policy directive from the $csp modifier
+
+	replace *replaceModifier // $replace modifier. nil for the whitelist rules disabling all of them.
+	cookie  *cookieModifier  // $cookie modifier
+
+	removeParam *removeParamModifier // $removeparam modifier
+	header      *headerModifier      // $header modifier
+	dnsRewrite  *DNSRewrite          // $dnsrewrite modifier. nil for the whitelist rules disabling all of them.
+
 	pattern string         // Pattern is the basic rule pattern ready to be compiled to regex
 	regex   *regexp.Regexp // Regex is the regular expression compiled from the pattern
 	invalid bool           // Marker that the rule is invalid. Match will always return false in this case
 
+	storageIdx int64 // index of the rule in the RuleStorage. It defines the order of the rules in the list.
+
 	sync.Mutex
 }
 
@@ -119,7 +221,9 @@ func NewNetworkRule(ruleText string, filterListID int) (*NetworkRule, error) {
 	if pattern == MaskStartURL || pattern == MaskPipe ||
 		pattern == MaskAnyCharacter || pattern == "" ||
 		len(pattern) < 3 {
-		if len(rule.permittedDomains) == 0 {
+		// Generic $csp, $cookie and $removeparam rules modify requests, they don't block them
+		if len(rule.permittedDomains) == 0 && len(rule.permittedApps) == 0 &&
+			rule.enabledOptions&(OptionCsp|OptionCookie|OptionRemoveParam) == 0 {
 			// Rule matches too much and does not have any domain restriction
 			// We should not allow this kind of rules
 			return nil, fmt.Errorf("the rule is too wide, add domain restriction or make it more specific")
@@ -147,7 +251,27 @@ func (f *NetworkRule) String() string {
 }
 
 // Match checks if this filtering rule matches the specified request
+// $header rules never match here as they need the response headers, use MatchResponseHeaders instead
 func (f *NetworkRule) Match(r *Request) bool {
+	if f.header != nil {
+		return false
+	}
+
+	return f.matchRequest(r)
+}
+
+// MatchResponseHeaders checks if this $header rule matches the specified request and its response headers
+// It returns false if the rule does not have the $header modifier
+func (f *NetworkRule) MatchResponseHeaders(r *Request, headers http.Header) bool {
+	if f.header == nil || !f.header.match(headers) {
+		return false
+	}
+
+	return f.matchRequest(r)
+}
+
+// matchRequest checks if the request matches all the rule constraints except for the $header modifier
+func (f *NetworkRule) matchRequest(r *Request) bool {
 	if !f.matchShortcut(r) {
 		return false
 	}
@@ -164,10 +288,30 @@ func (f *NetworkRule) Match(r *Request) bool {
 		return false
 	}
 
+	if !f.matchMethod(r.Method) {
+		return false
+	}
+
 	if !f.matchDomain(r.SourceHostname) {
 		return false
 	}
 
+	if !f.matchDenyAllow(r.Hostname) {
+		return false
+	}
+
+	if !f.matchApp(r.App) {
+		return false
+	}
+
+	if !f.clients.match(r.ClientIP, r.ClientName) || !f.clientTags.match(r.ClientTags) {
+		return false
+	}
+
+	if !f.matchDNSType(r.DNSType) {
+		return false
+	}
+
 	return f.matchPattern(r)
 }
 
@@ -181,6 +325,91 @@ func (f *NetworkRule) IsOptionDisabled(option NetworkRuleOption) bool {
 	return (f.disabledOptions & option) == option
 }
 
+// isGeneric returns true if the rule is not limited to any specific domain
+func (f *NetworkRule) isGeneric() bool {
+	return len(f.permittedDomains) == 0
+}
+
+// isDocumentWhitelistRule returns true if this is a document-level whitelist rule
+// that disables blocking on the whole page ($document, $urlblock, $genericblock, $content)
+func (f *NetworkRule) isDocumentWhitelistRule() bool {
+	if !f.Whitelist {
+		return false
+	}
+
+	return f.IsOptionEnabled(OptionUrlblock) ||
+		f.IsOptionEnabled(OptionGenericblock) ||
+		f.IsOptionEnabled(OptionContent)
+}
+
+// negatesBadfilter checks if this $badfilter rule disables the specified rule.
+// The rules must be identical except for the $badfilter modifier.
+// The only exception is $domain: if the rule has several permitted domains,
+// it is enough for the $badfilter rule to have at least one of them.
+// As the $badfilter rule only matches requests from its own domains,
+// the rule is disabled on these domains only.
+func (f *NetworkRule) negatesBadfilter(r *NetworkRule) bool {
+	if !f.IsOptionEnabled(OptionBadfilter) {
+		return false
+	}
+
+	if f.Whitelist != r.Whitelist ||
+		f.pattern != r.pattern ||
+		f.permittedRequestTypes != r.permittedRequestTypes ||
+		f.restrictedRequestTypes != r.restrictedRequestTypes ||
+		f.permittedMethods != r.permittedMethods ||
+		f.restrictedMethods != r.restrictedMethods {
+		return false
+	}
+
+	if (f.enabledOptions^OptionBadfilter) != r.enabledOptions ||
+		f.disabledOptions != r.disabledOptions ||
+		f.redirect != r.redirect ||
+		f.csp != r.csp ||
+		f.getReplaceValue() != r.getReplaceValue() ||
+		f.getCookieValue() != r.getCookieValue() ||
+		f.getRemoveParamValue() != r.getRemoveParamValue() ||
+		f.getHeaderValue() != r.getHeaderValue() ||
+		f.getDNSRewriteValue() != r.getDNSRewriteValue() ||
+		f.clients.String() != r.clients.String() ||
+		f.clientTags.String() != r.clientTags.String() ||
+		!dnsTypesEquals(f.permittedDNSTypes, r.permittedDNSTypes) ||
+		!dnsTypesEquals(f.restrictedDNSTypes, r.restrictedDNSTypes) {
+		return false
+	}
+
+	if !stringArraysEquals(f.restrictedDomains, r.restrictedDomains) ||
+		!stringArraysEquals(f.denyAllowDomains, r.denyAllowDomains) ||
+		!stringArraysEquals(f.permittedApps, r.permittedApps) ||
+		!stringArraysEquals(f.restrictedApps, r.restrictedApps) {
+		return false
+	}
+
+	if len(f.permittedDomains) == 0 || len(r.permittedDomains) == 0 {
+		return len(f.permittedDomains) == len(r.permittedDomains)
+	}
+
+	return stringArraysHaveIntersection(f.permittedDomains, r.permittedDomains)
+}
+
+// isRedirectRule returns true if the rule has a $redirect or $redirect-rule modifier
+func (f *NetworkRule) isRedirectRule() bool {
+	return f.IsOptionEnabled(OptionRedirect) || f.IsOptionEnabled(OptionRedirectRule) || f.redirect != ""
+}
+
+// isModifyingRule returns true if the rule does not block or allow the request by itself,
+// but modifies the request, the response or the DNS answer instead
+func (f *NetworkRule) isModifyingRule() bool {
+	if f.IsOptionEnabled(OptionCsp) || f.IsOptionEnabled(OptionCookie) ||
+		f.IsOptionEnabled(OptionRemoveParam) || f.IsOptionEnabled(OptionReplace) ||
+		f.IsOptionEnabled(OptionDNSRewrite) || f.IsOptionEnabled(OptionRedirectRule) {
+		return true
+	}
+
+	// Whitelist redirect rules only disable redirects
+	return f.Whitelist && f.isRedirectRule()
+}
+
 // isRegexRule returns true if rule's pattern is a regular expression
 func (f *NetworkRule) isRegexRule() bool {
 	if strings.HasPrefix(f.pattern, maskRegexRule) &&
@@ -273,6 +502,69 @@ func (f *NetworkRule) matchDomain(domain string) bool {
 	return true
 }
 
+// matchMethod checks if the request HTTP method matches the $method modifier.
+// If the method is unknown, only the rules that don't permit specific methods match the request.
+func (f *NetworkRule) matchMethod(method string) bool {
+	if f.permittedMethods == 0 && f.restrictedMethods == 0 {
+		return true
+	}
+
+	m := requestMethods[strings.ToLower(method)]
+	if f.permittedMethods != 0 && (f.permittedMethods&m) == 0 {
+		return false
+	}
+
+	return (f.restrictedMethods & m) == 0
+}
+
+// matchDenyAllow checks if the request hostname is not excluded by the $denyallow modifier
+func (f *NetworkRule) matchDenyAllow(hostname string) bool {
+	if len(f.denyAllowDomains) == 0 {
+		return true
+	}
+
+	// i.e. $denyallow=example.org and we're checking example.org or sub.example.org
+	return !isDomainOrSubdomainOfAny(hostname, f.denyAllowDomains)
+}
+
+// matchApp checks if the rule is allowed for the application that sent the request.
+// If the application is unknown, only the rules that don't permit specific applications match the request.
+func (f *NetworkRule) matchApp(app string) bool {
+	if len(f.permittedApps) == 0 && len(f.restrictedApps) == 0 {
+		return true
+	}
+
+	app = strings.ToLower(app)
+	if len(f.permittedApps) > 0 && !stringArrayContains(f.permittedApps, app) {
+		return false
+	}
+
+	return !stringArrayContains(f.restrictedApps, app)
+}
+
+// matchDNSType checks if the DNS query type matches the $dnstype modifier.
+// If the query type is unknown (i.e. this is not a DNS request),
+// only the rules that don't permit specific types match the request.
+func (f *NetworkRule) matchDNSType(dnsType uint16) bool {
+	for _, t := range f.restrictedDNSTypes {
+		if t == dnsType {
+			return false
+		}
+	}
+
+	if len(f.permittedDNSTypes) == 0 {
+		return true
+	}
+
+	for _, t := range f.permittedDNSTypes {
+		if t == dnsType {
+			return true
+		}
+	}
+
+	return false
+}
+
 // matchRequestType checks if the specified request type matches the rule properties
 func (f *NetworkRule) matchRequestType(requestType RequestType) bool {
 	if f.permittedRequestTypes != 0 {
@@ -353,12 +645,25 @@ func (f *NetworkRule) loadOptions(options string) error {
 		f.permittedRequestTypes = TypeDocument
 	}
 
+	// $csp rules are applied to documents and subdocuments by default
+	if f.IsOptionEnabled(OptionCsp) && f.permittedRequestTypes == 0 {
+		f.permittedRequestTypes = TypeDocument | TypeSubdocument
+	}
+
 	return nil
 }
 
 // loadOption loads specified option with its value (optional)
 // nolint:gocyclo
 func (f *NetworkRule) loadOption(name string, value string) error {
+	if alias, ok := optionAliases[name]; ok {
+		name = alias
+	}
+
+	if reason, ok := unsupportedOptions[name]; ok {
+		return &UnsupportedModifierError{Modifier: name, Reason: reason}
+	}
+
 	switch name {
 	// General options
 	case "third-party", "~first-party":
@@ -371,6 +676,8 @@ func (f *NetworkRule) loadOption(name string, value string) error {
 		return f.setOptionEnabled(OptionMatchCase, false)
 	case "important":
 		return f.setOptionEnabled(OptionImportant, true)
+	case "badfilter":
+		return f.setOptionEnabled(OptionBadfilter, true)
 
 	case "domain":
 		permitted, restricted, err := loadDomains(value, "|")
@@ -378,6 +685,32 @@ func (f *NetworkRule) loadOption(name string, value string) error {
 		f.restrictedDomains = restricted
 		return err
 
+	// $denyallow excludes the request domains from the rule
+	case "denyallow":
+		return f.setDenyAllow(value)
+
+	// $method limits the rule to the specified HTTP methods
+	case "method":
+		return f.setMethods(value)
+
+	// $app limits the rule to the specified applications
+	case "app":
+		return f.setApps(value)
+
+	// $dnstype limits the rule to the specified DNS query types
+	case "dnstype":
+		return f.setDNSTypes(value)
+
+	// $client and $ctag limit the rule to the specified DNS clients
+	case "client":
+		clients, err := parseClientsModifier(value)
+		f.clients = clients
+		return err
+	case "ctag":
+		clientTags, err := parseClientTagsModifier(value)
+		f.clientTags = clientTags
+		return err
+
 	// Document-level whitelist rules
 	case "elemhide":
 		return f.setOptionEnabled(OptionElemhide, true)
@@ -403,6 +736,9 @@ func (f *NetworkRule) loadOption(name string, value string) error {
 
 	// $document
 	case "document":
+		if !f.Whitelist {
+			return &UnsupportedModifierError{Modifier: name, Reason: "blocking rules cannot block documents"}
+		}
 		err := f.setOptionEnabled(OptionElemhide, true)
 		// Ignore others
 		_ = f.setOptionEnabled(OptionJsinject, true)
@@ -420,12 +756,52 @@ func (f *NetworkRule) loadOption(name string, value string) error {
 		return f.setOptionEnabled(OptionPopup, true)
 
 	// $empty and $mp4
-	// TODO: Deprecate in favor of $redirect
+	// These are deprecated, use $redirect instead
 	case "empty":
+		f.redirect = "nooptext"
 		return f.setOptionEnabled(OptionEmpty, true)
 	case "mp4":
+		f.redirect = "noopmp4-1s"
 		return f.setOptionEnabled(OptionMp4, true)
 
+	// $csp
+	case "csp":
+		return f.setCsp(value)
+	case "inline-script":
+		return f.setCsp(inlineScriptCsp)
+
+	// $replace
+	case "replace":
+		return f.setReplace(value)
+
+	// $cookie
+	case "cookie":
+		return f.setCookie(value)
+
+	// $removeparam
+	case "removeparam":
+		return f.setRemoveParam(value)
+
+	// $header
+	case "header":
+		return f.setHeader(value)
+
+	// $dnsrewrite
+	case "dnsrewrite":
+		return f.setDNSRewrite(value)
+
+	// $redirect and $redirect-rule
+	case "redirect":
+		return f.setRedirect(OptionRedirect, value)
+	case "redirect-rule":
+		return f.setRedirect(OptionRedirectRule, value)
+	case "rewrite":
+		return f.setRewrite(value)
+
+	// uBlock Origin $to is supported only as an equivalent of $denyallow
+	case "to":
+		return f.setTo(value)
+
 	// Content type options
 	case "script":
 		f.setRequestType(TypeScript, true)
@@ -493,11 +869,347 @@ func (f *NetworkRule) loadOption(name string, value string) error {
 	case "~other":
 		f.setRequestType(TypeOther, false)
 		return nil
+	case "ping":
+		f.setRequestType(TypePing, true)
+		return nil
+	case "~ping":
+		f.setRequestType(TypePing, false)
+		return nil
+	case "csp_report":
+		f.setRequestType(TypeCSPReport, true)
+		return nil
+	case "~csp_report":
+		f.setRequestType(TypeCSPReport, false)
+		return nil
+	case "webrtc":
+		f.setRequestType(TypeWebRTC, true)
+		return nil
+	case "~webrtc":
+		f.setRequestType(TypeWebRTC, false)
+		return nil
 	}
 
 	return fmt.Errorf("unknown filter modifier: %s=%s", name, value)
 }
 
+// setRedirect enables the $redirect or $redirect-rule modifier with the specified resource name
+// The resource name can be omitted in whitelist rules only, such rules disable all redirects
+func (f *NetworkRule) setRedirect(option NetworkRuleOption, value string) error {
+	if value == "" && !f.Whitelist {
+		return fmt.Errorf("redirect resource is not specified")
+	}
+
+	if value != "" && GetRedirectResource(value) == nil {
+		return fmt.Errorf("unknown redirect resource: %s", value)
+	}
+
+	f.redirect = value
+	return f.setOptionEnabled(option, true)
+}
+
+// setRewrite converts the Adblock Plus $rewrite=abp-resource:name modifier to $redirect
+func (f *NetworkRule) setRewrite(value string) error {
+	const prefix = "abp-resource:"
+	if !strings.HasPrefix(value, prefix) {
+		return &UnsupportedModifierError{Modifier: "rewrite", Reason: "only abp-resource values are supported"}
+	}
+
+	name, ok := abpResources[value[len(prefix):]]
+	if !ok {
+		return &UnsupportedModifierError{Modifier: "rewrite", Reason: "unknown resource " + value}
+	}
+
+	return f.setRedirect(OptionRedirect, name)
+}
+
+// setTo converts the uBlock Origin $to modifier.
+// $to=~a.com|~b.com is the same as $denyallow=a.com|b.com, other values have no equivalent.
+func (f *NetworkRule) setTo(value string) error {
+	permitted, restricted, err := loadDomains(value, "|")
+	if err != nil {
+		return err
+	}
+
+	if len(permitted) > 0 {
+		return &UnsupportedModifierError{Modifier: "to", Reason: "only negated domains are supported"}
+	}
+
+	f.denyAllowDomains = restricted
+	return nil
+}
+
+// setDenyAllow sets the list of the request domains excluded by the $denyallow modifier
+// Negated domains are not allowed there
+func (f *NetworkRule) setDenyAllow(value string) error {
+	permitted, restricted, err := loadDomains(value, "|")
+	if err != nil {
+		return err
+	}
+
+	if len(restricted) > 0 {
+		return fmt.Errorf("negated domains are not allowed in $denyallow: %s", value)
+	}
+
+	f.denyAllowDomains = permitted
+	return nil
+}
+
+// setMethods parses the $method modifier value: get|post or ~put|~delete
+// Permitted and restricted methods cannot be mixed in one rule
+func (f *NetworkRule) setMethods(value string) error {
+	if value == "" {
+		return fmt.Errorf("no methods specified")
+	}
+
+	for _, name := range strings.Split(value, "|") {
+		restricted := strings.HasPrefix(name, "~")
+		if restricted {
+			name = name[1:]
+		}
+
+		m, ok := requestMethods[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("unknown method: %s", name)
+		}
+
+		if restricted {
+			f.restrictedMethods |= m
+		} else {
+			f.permittedMethods |= m
+		}
+	}
+
+	if f.permittedMethods != 0 && f.restrictedMethods != 0 {
+		return fmt.Errorf("permitted and restricted methods cannot be mixed: %s", value)
+	}
+
+	return nil
+}
+
+// setApps parses the $app modifier value: org.example.app|~com.browser
+// Application names are case-insensitive and can contain letters, digits, ".", "_" and "-"
+func (f *NetworkRule) setApps(value string) error {
+	if value == "" {
+		return fmt.Errorf("no apps specified")
+	}
+
+	for _, app := range strings.Split(value, "|") {
+		restricted := strings.HasPrefix(app, "~")
+		if restricted {
+			app = app[1:]
+		}
+
+		if !isValidAppName(app) {
+			return fmt.Errorf("invalid app name: %s", app)
+		}
+
+		app = strings.ToLower(app)
+		if restricted {
+			f.restrictedApps = append(f.restrictedApps, app)
+		} else {
+			f.permittedApps = append(f.permittedApps, app)
+		}
+	}
+
+	return nil
+}
+
+// isValidAppName checks if the string is a valid application identifier
+func isValidAppName(app string) bool {
+	if app == "" {
+		return false
+	}
+
+	for _, c := range app {
+		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') &&
+			c != '.' && c != '_' && c != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setDNSTypes parses the $dnstype modifier value: AAAA|~A
+func (f *NetworkRule) setDNSTypes(value string) error {
+	if value == "" {
+		return fmt.Errorf("no DNS types specified")
+	}
+
+	for _, name := range strings.Split(value, "|") {
+		restricted := strings.HasPrefix(name, "~")
+		if restricted {
+			name = name[1:]
+		}
+
+		t, ok := dnsQueryTypes[strings.ToUpper(name)]
+		if !ok {
+			return fmt.Errorf("unknown DNS type: %s", name)
+		}
+
+		if restricted {
+			f.restrictedDNSTypes = append(f.restrictedDNSTypes, t)
+		} else {
+			f.permittedDNSTypes = append(f.permittedDNSTypes, t)
+		}
+	}
+
+	return nil
+}
+
+// dnsTypesEquals checks if the two lists of DNS types are equal
+func dnsTypesEquals(l []uint16, r []uint16) bool {
+	if len(l) != len(r) {
+		return false
+	}
+
+	for i := range l {
+		if l[i] != r[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setCsp enables the $csp modifier with the specified Content-Security-Policy directive
+// The directive can be omitted in whitelist rules only, such rules disable all $csp rules
+func (f *NetworkRule) setCsp(value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" && !f.Whitelist {
+		return fmt.Errorf("content security policy is not specified")
+	}
+
+	// Reporting directives could be used to track users
+	lowerCase := strings.ToLower(value)
+	if strings.Contains(lowerCase, "report-uri") || strings.Contains(lowerCase, "report-to") {
+		return fmt.Errorf("forbidden content security policy directive: %s", value)
+	}
+
+	f.csp = value
+	return f.setOptionEnabled(OptionCsp, true)
+}
+
+// setReplace enables the $replace modifier
+// The value can be omitted in whitelist rules only, such rules disable all $replace rules
+func (f *NetworkRule) setReplace(value string) error {
+	if value == "" {
+		if !f.Whitelist {
+			return fmt.Errorf("$replace value is not specified")
+		}
+		return f.setOptionEnabled(OptionReplace, true)
+	}
+
+	m, err := parseReplaceModifier(value)
+	if err != nil {
+		return err
+	}
+
+	f.replace = m
+	return f.setOptionEnabled(OptionReplace, true)
+}
+
+// getReplaceValue returns the original value of the $replace modifier
+func (f *NetworkRule) getReplaceValue() string {
+	if f.replace == nil {
+		return ""
+	}
+	return f.replace.text
+}
+
+// setCookie enables the $cookie modifier
+func (f *NetworkRule) setCookie(value string) error {
+	m, err := parseCookieModifier(value)
+	if err != nil {
+		return err
+	}
+
+	f.cookie = m
+	return f.setOptionEnabled(OptionCookie, true)
+}
+
+// getCookieValue returns the original value of the $cookie modifier
+func (f *NetworkRule) getCookieValue() string {
+	if f.cookie == nil {
+		return ""
+	}
+	return f.cookie.text
+}
+
+// getCookieName returns the cookie name or regex from the $cookie modifier without the cookie options.
+// Rules with the same name are applied to the same cookies.
+func (f *NetworkRule) getCookieName() string {
+	if f.cookie == nil {
+		return ""
+	}
+	if f.cookie.regex != nil {
+		return maskRegexRule + f.cookie.regex.String() + maskRegexRule
+	}
+	return f.cookie.name
+}
+
+// setRemoveParam enables the $removeparam modifier
+func (f *NetworkRule) setRemoveParam(value string) error {
+	m, err := parseRemoveParamModifier(value)
+	if err != nil {
+		return err
+	}
+
+	f.removeParam = m
+	return f.setOptionEnabled(OptionRemoveParam, true)
+}
+
+// getRemoveParamValue returns the original value of the $removeparam modifier
+func (f *NetworkRule) getRemoveParamValue() string {
+	if f.removeParam == nil {
+		return ""
+	}
+	return f.removeParam.text
+}
+
+// setHeader enables the $header modifier
+func (f *NetworkRule) setHeader(value string) error {
+	m, err := parseHeaderModifier(value)
+	if err != nil {
+		return err
+	}
+
+	f.header = m
+	return f.setOptionEnabled(OptionHeader, true)
+}
+
+// getHeaderValue returns the original value of the $header modifier
+func (f *NetworkRule) getHeaderValue() string {
+	if f.header == nil {
+		return ""
+	}
+	return f.header.text
+}
+
+// setDNSRewrite enables the $dnsrewrite modifier
+// The value can be omitted in whitelist rules only, such rules disable all $dnsrewrite rules
+func (f *NetworkRule) setDNSRewrite(value string) error {
+	if value == "" && f.Whitelist {
+		return f.setOptionEnabled(OptionDNSRewrite, true)
+	}
+
+	rw, err := parseDNSRewrite(value)
+	if err != nil {
+		return err
+	}
+
+	f.dnsRewrite = rw
+	return f.setOptionEnabled(OptionDNSRewrite, true)
+}
+
+// getDNSRewriteValue returns the original value of the $dnsrewrite modifier
+func (f *NetworkRule) getDNSRewriteValue() string {
+	if f.dnsRewrite == nil {
+		return ""
+	}
+	return f.dnsRewrite.text
+}
+
 // loadShortcut extracts a shortcut from the pattern.
 // shortcut is the longest substring of the pattern that does not contain
 // any special characters
@@ -1,6 +1,7 @@
 package urlfilter
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -170,6 +171,16 @@ func TestParseRequestTypeModifiers(t *testing.T) {
 
 	checkRequestType(t, "other", TypeOther, true)
 	checkRequestType(t, "~other", TypeOther, false)
+
+	checkRequestType(t, "ping", TypePing, true)
+	checkRequestType(t, "~ping", TypePing, false)
+	checkRequestType(t, "beacon", TypePing, true)
+
+	checkRequestType(t, "csp_report", TypeCSPReport, true)
+	checkRequestType(t, "~csp_report", TypeCSPReport, false)
+
+	checkRequestType(t, "webrtc", TypeWebRTC, true)
+	checkRequestType(t, "~webrtc", TypeWebRTC, false)
 }
 
 func TestFindShortcut(t *testing.T) {
@@ -415,3 +426,346 @@ func compareRulesPriority(t *testing.T, left string, right string, expected bool
 	assert.Nil(t, err)
 	assert.Equal(t, expected, l.isHigherPriority(r))
 }
+
+func TestBadfilterRule(t *testing.T) {
+	checkBadfilter(t, "||example.org^", "||example.org^$badfilter", true)
+	checkBadfilter(t, "||example.org^", "@@||example.org^$badfilter", false)
+	checkBadfilter(t, "@@||example.org^", "@@||example.org^$badfilter", true)
+	checkBadfilter(t, "||example.org^", "||example.org^$script,badfilter", false)
+	checkBadfilter(t, "||example.org^$script", "||example.org^$script,badfilter", true)
+	checkBadfilter(t, "||example.org^$third-party", "||example.org^$badfilter", false)
+	checkBadfilter(t, "||example.org^$third-party", "||example.org^$third-party,badfilter", true)
+	checkBadfilter(t, "||example.org^", "||example.com^$badfilter", false)
+
+	// Domains
+	checkBadfilter(t, "||example.org^", "||example.org^$domain=a.com,badfilter", false)
+	checkBadfilter(t, "||example.org^$domain=a.com", "||example.org^$badfilter", false)
+	checkBadfilter(t, "||example.org^$domain=a.com", "||example.org^$domain=a.com,badfilter", true)
+	checkBadfilter(t, "||example.org^$domain=a.com|b.com", "||example.org^$domain=a.com,badfilter", true)
+	checkBadfilter(t, "||example.org^$domain=a.com|b.com", "||example.org^$domain=c.com,badfilter", false)
+	checkBadfilter(t, "||example.org^$domain=~a.com", "||example.org^$domain=~a.com,badfilter", true)
+	checkBadfilter(t, "||example.org^$domain=~a.com|~b.com", "||example.org^$domain=~a.com,badfilter", false)
+}
+
+func checkBadfilter(t *testing.T, ruleText string, badfilterText string, expected bool) {
+	rule, err := NewNetworkRule(ruleText, -1)
+	assert.Nil(t, err)
+	badfilter, err := NewNetworkRule(badfilterText, -1)
+	assert.Nil(t, err)
+	assert.True(t, badfilter.IsOptionEnabled(OptionBadfilter))
+	assert.Equal(t, expected, badfilter.negatesBadfilter(rule), ruleText+" "+badfilterText)
+}
+
+func TestRedirectModifier(t *testing.T) {
+	f, err := NewNetworkRule("||example.org^$script,redirect=noopjs", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.True(t, f.IsOptionEnabled(OptionRedirect))
+	assert.Equal(t, "noopjs", f.redirect)
+
+	f, err = NewNetworkRule("||example.org^$redirect-rule=noopjs", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.True(t, f.IsOptionEnabled(OptionRedirectRule))
+	assert.Equal(t, "noopjs", f.redirect)
+
+	f, err = NewNetworkRule("@@||example.org^$redirect", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.True(t, f.IsOptionEnabled(OptionRedirect))
+	assert.Equal(t, "", f.redirect)
+
+	// $empty and $mp4 are aliases
+	f, err = NewNetworkRule("||example.org^$empty", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "nooptext", f.redirect)
+	f, err = NewNetworkRule("||example.org^$mp4", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "noopmp4-1s", f.redirect)
+
+	_, err = NewNetworkRule("||example.org^$redirect", 0)
+	assert.NotNil(t, err)
+	_, err = NewNetworkRule("||example.org^$redirect=unknown", 0)
+	assert.NotNil(t, err)
+
+	// $redirect-rule exceptions are allowed
+	f, err = NewNetworkRule("@@||example.org^$redirect-rule=noopjs", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.True(t, f.IsOptionEnabled(OptionRedirectRule))
+	assert.Equal(t, "noopjs", f.redirect)
+}
+
+func TestCspModifier(t *testing.T) {
+	f, err := NewNetworkRule("||example.org^$csp=script-src 'self'", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.True(t, f.IsOptionEnabled(OptionCsp))
+	assert.Equal(t, "script-src 'self'", f.csp)
+	assert.Equal(t, TypeDocument|TypeSubdocument, f.permittedRequestTypes)
+
+	f, err = NewNetworkRule("@@||example.org^$csp", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.True(t, f.IsOptionEnabled(OptionCsp))
+	assert.Equal(t, "", f.csp)
+
+	_, err = NewNetworkRule("||example.org^$csp", 0)
+	assert.NotNil(t, err)
+	_, err = NewNetworkRule("||example.org^$csp=report-uri https://example.com/", 0)
+	assert.NotNil(t, err)
+}
+
+func TestReplaceModifier(t *testing.T) {
+	f, err := NewNetworkRule("||example.org^$replace=/(ad\\,s)/\\$1-x/i", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.True(t, f.IsOptionEnabled(OptionReplace))
+	assert.Equal(t, "/(ad,s)/$1-x/i", f.getReplaceValue())
+	assert.Equal(t, "AD,S-x", string(f.replace.apply([]byte("AD,S"))))
+
+	f, err = NewNetworkRule("/banner/$replace=/banner//", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Equal(t, "/banner/", f.pattern)
+	assert.Equal(t, "/banner//", f.getReplaceValue())
+
+	f, err = NewNetworkRule("@@||example.org^$replace", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.True(t, f.IsOptionEnabled(OptionReplace))
+	assert.Nil(t, f.replace)
+
+	_, err = NewNetworkRule("||example.org^$replace", 0)
+	assert.NotNil(t, err)
+	_, err = NewNetworkRule("||example.org^$replace=/ad/", 0)
+	assert.NotNil(t, err)
+}
+
+func TestCookieModifier(t *testing.T) {
+	f, err := NewNetworkRule("||example.org^$third-party,cookie=NAME;maxAge=3600", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.True(t, f.IsOptionEnabled(OptionCookie))
+	assert.True(t, f.IsOptionEnabled(OptionThirdParty))
+	assert.Equal(t, "NAME;maxAge=3600", f.getCookieValue())
+
+	f, err = NewNetworkRule("@@||example.org^$cookie", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.True(t, f.IsOptionEnabled(OptionCookie))
+	assert.Equal(t, "", f.getCookieValue())
+
+	_, err = NewNetworkRule("||example.org^$cookie=NAME;maxAge=-1", 0)
+	assert.NotNil(t, err)
+}
+
+func TestDenyAllowModifier(t *testing.T) {
+	f, err := NewNetworkRule("*$script,domain=a.com|b.com,denyallow=x.com|y.com", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Equal(t, []string{"x.com", "y.com"}, f.denyAllowDomains)
+
+	r := NewRequest("https://z.com/script.js", "https://a.com/", TypeScript)
+	assert.True(t, f.Match(r))
+	r = NewRequest("https://x.com/script.js", "https://a.com/", TypeScript)
+	assert.False(t, f.Match(r))
+	r = NewRequest("https://sub.y.com/script.js", "https://b.com/", TypeScript)
+	assert.False(t, f.Match(r))
+	r = NewRequest("https://z.com/script.js", "https://c.com/", TypeScript)
+	assert.False(t, f.Match(r))
+
+	_, err = NewNetworkRule("*$domain=a.com,denyallow=~x.com", 0)
+	assert.NotNil(t, err)
+	_, err = NewNetworkRule("*$domain=a.com,denyallow=", 0)
+	assert.NotNil(t, err)
+}
+
+func TestMethodModifier(t *testing.T) {
+	f, err := NewNetworkRule("||example.org^$method=post|PUT", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+
+	r := NewRequest("https://example.org/", "", TypeXmlhttprequest)
+	assert.False(t, f.Match(r))
+	r.Method = "POST"
+	assert.True(t, f.Match(r))
+	r.Method = "put"
+	assert.True(t, f.Match(r))
+	r.Method = "GET"
+	assert.False(t, f.Match(r))
+
+	f, err = NewNetworkRule("||example.org^$method=~get", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	r.Method = "GET"
+	assert.False(t, f.Match(r))
+	r.Method = "POST"
+	assert.True(t, f.Match(r))
+	r.Method = ""
+	assert.True(t, f.Match(r))
+
+	_, err = NewNetworkRule("||example.org^$method=get|~post", 0)
+	assert.NotNil(t, err)
+	_, err = NewNetworkRule("||example.org^$method=unknown", 0)
+	assert.NotNil(t, err)
+	_, err = NewNetworkRule("||example.org^$method=", 0)
+	assert.NotNil(t, err)
+}
+
+func TestAppModifier(t *testing.T) {
+	f, err := NewNetworkRule("||example.org^$app=Org.Example.App|com.example.app2", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Equal(t, []string{"org.example.app", "com.example.app2"}, f.permittedApps)
+
+	r := NewRequest("https://example.org/", "", TypeOther)
+	assert.False(t, f.Match(r))
+	r.App = "org.example.app"
+	assert.True(t, f.Match(r))
+	r.App = "COM.EXAMPLE.APP2"
+	assert.True(t, f.Match(r))
+	r.App = "com.browser"
+	assert.False(t, f.Match(r))
+
+	f, err = NewNetworkRule("||example.org^$app=~com.browser", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Equal(t, []string{"com.browser"}, f.restrictedApps)
+	assert.False(t, f.Match(r))
+	r.App = ""
+	assert.True(t, f.Match(r))
+
+	// Rules limited to specific apps are not too wide
+	_, err = NewNetworkRule("$app=org.example.app", 0)
+	assert.Nil(t, err)
+
+	_, err = NewNetworkRule("||example.org^$app=", 0)
+	assert.NotNil(t, err)
+	_, err = NewNetworkRule("||example.org^$app=org.example.app|~", 0)
+	assert.NotNil(t, err)
+	_, err = NewNetworkRule("||example.org^$app=org/example", 0)
+	assert.NotNil(t, err)
+}
+
+func TestCompatibilityModifiers(t *testing.T) {
+	checkSameRule := func(ruleText string, equivalent string) {
+		f, err := NewNetworkRule(ruleText, 0)
+		assert.Nil(t, err, ruleText)
+		e, err := NewNetworkRule(equivalent, 0)
+		assert.Nil(t, err, equivalent)
+		if f == nil || e == nil {
+			return
+		}
+
+		assert.Equal(t, e.enabledOptions, f.enabledOptions, ruleText)
+		assert.Equal(t, e.disabledOptions, f.disabledOptions, ruleText)
+		assert.Equal(t, e.permittedRequestTypes, f.permittedRequestTypes, ruleText)
+		assert.Equal(t, e.restrictedRequestTypes, f.restrictedRequestTypes, ruleText)
+		assert.Equal(t, e.permittedDomains, f.permittedDomains, ruleText)
+		assert.Equal(t, e.denyAllowDomains, f.denyAllowDomains, ruleText)
+		assert.Equal(t, e.redirect, f.redirect, ruleText)
+		assert.Equal(t, e.csp, f.csp, ruleText)
+	}
+
+	checkSameRule("||example.org^$1p", "||example.org^$~third-party")
+	checkSameRule("||example.org^$~1p", "||example.org^$third-party")
+	checkSameRule("||example.org^$3p", "||example.org^$third-party")
+	checkSameRule("||example.org^$~3p", "||example.org^$~third-party")
+	checkSameRule("||example.org^$frame,~xhr,css", "||example.org^$subdocument,~xmlhttprequest,stylesheet")
+	checkSameRule("@@||example.org^$ghide,ehide", "@@||example.org^$generichide,elemhide")
+	checkSameRule("@@||example.org^$doc", "@@||example.org^$document")
+	checkSameRule("||example.org^$script,from=a.com|b.com", "||example.org^$script,domain=a.com|b.com")
+	checkSameRule("*$script,domain=a.com,to=~x.com|~y.com", "*$script,domain=a.com,denyallow=x.com|y.com")
+	checkSameRule("||example.org^$inline-script", "||example.org^$csp=script-src 'unsafe-eval' * blob: data:")
+	checkSameRule("||example.org^$rewrite=abp-resource:blank-js", "||example.org^$redirect=noopjs")
+
+	checkUnsupported := func(ruleText string, modifier string) {
+		_, err := NewNetworkRule(ruleText, 0)
+		assert.NotNil(t, err, ruleText)
+		unsupportedErr, ok := err.(*UnsupportedModifierError)
+		assert.True(t, ok, ruleText)
+		if ok {
+			assert.Equal(t, modifier, unsupportedErr.Modifier)
+		}
+		assert.True(t, errors.Is(err, ErrUnsupportedRule), ruleText)
+	}
+
+	checkUnsupported("||example.org^$all", "all")
+	checkUnsupported("||example.org^$strict3p", "strict3p")
+	checkUnsupported("||example.org^$popunder", "popunder")
+	checkUnsupported("*$domain=a.com,to=x.com", "to")
+	checkUnsupported("||example.org^$rewrite=abp-resource:unknown", "rewrite")
+	checkUnsupported("||example.org^$rewrite=/ads/", "rewrite")
+
+	// $doc and $document are limited to whitelist rules
+	checkUnsupported("||example.org^$doc", "document")
+	checkUnsupported("||example.org^$document", "document")
+
+	// Unknown modifiers are still syntax errors
+	_, err := NewNetworkRule("||example.org^$unknown", 0)
+	assert.NotNil(t, err)
+	_, ok := err.(*UnsupportedModifierError)
+	assert.False(t, ok)
+}
+
+func TestNewRequestTypes(t *testing.T) {
+	f, err := NewNetworkRule("||example.org^$ping,webrtc", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+
+	assert.True(t, f.Match(NewRequest("https://example.org/", "", TypePing)))
+	assert.True(t, f.Match(NewRequest("https://example.org/", "", TypeWebRTC)))
+	assert.False(t, f.Match(NewRequest("https://example.org/", "", TypeScript)))
+	assert.False(t, f.Match(NewRequest("https://example.org/", "", TypeCSPReport)))
+	assert.False(t, f.Match(NewRequestForHostname("example.org")))
+
+	// Rules limited to web request types don't match DNS queries
+	f, err = NewNetworkRule("||example.org^$subdocument", 0)
+	assert.Nil(t, err)
+	assert.False(t, f.Match(NewRequestForHostname("example.org")))
+
+	f, err = NewNetworkRule("||example.org^$~ping", 0)
+	assert.Nil(t, err)
+	assert.True(t, f.Match(NewRequestForHostname("example.org")))
+	assert.False(t, f.Match(NewRequest("https://example.org/", "", TypePing)))
+}
+
+func TestDNSTypeModifier(t *testing.T) {
+	f, err := NewNetworkRule("||example.org^$dnstype=AAAA|mx", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.Equal(t, []uint16{DNSTypeAAAA, DNSTypeMX}, f.permittedDNSTypes)
+
+	r := NewRequestForHostname("example.org")
+	assert.False(t, f.Match(r))
+	r.DNSType = DNSTypeAAAA
+	assert.True(t, f.Match(r))
+	r.DNSType = DNSTypeA
+	assert.False(t, f.Match(r))
+
+	f, err = NewNetworkRule("||example.org^$dnstype=~A", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, f)
+	assert.False(t, f.Match(r))
+	r.DNSType = DNSTypeAAAA
+	assert.True(t, f.Match(r))
+	r.DNSType = 0
+	assert.True(t, f.Match(r))
+
+	_, err = NewNetworkRule("||example.org^$dnstype=", 0)
+	assert.NotNil(t, err)
+	_, err = NewNetworkRule("||example.org^$dnstype=UNKNOWN", 0)
+	assert.NotNil(t, err)
+}
+
+func TestNetworkRuleOptionValues(t *testing.T) {
+	// The values of the exported options must not change
+	assert.Equal(t, NetworkRuleOption(1), OptionThirdParty)
+	assert.Equal(t, NetworkRuleOption(1<<2), OptionImportant)
+	assert.Equal(t, NetworkRuleOption(1<<3), OptionElemhide)
+	assert.Equal(t, NetworkRuleOption(1<<10), OptionStealth)
+	assert.Equal(t, NetworkRuleOption(1<<12), OptionMp4)
+	assert.Equal(t, NetworkRuleOption(1<<13), OptionPopup)
+	assert.Equal(t, NetworkRuleOption(1<<16), OptionCookie)
+}
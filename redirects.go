@@ -0,0 +1,212 @@
+package urlfilter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+)
+
+// RedirectResource is a resource that can be served instead of a blocked request
+// https://kb.adguard.com/en/general/how-to-create-your-own-ad-filters#redirect-modifier
+type RedirectResource struct {
+	Name        string // Name is the resource name that is used in the $redirect modifier
+	ContentType string // ContentType is the value of the Content-Type header
+	Content     []byte // Content is the response body
+}
+
+// abpResources maps the Adblock Plus $rewrite=abp-resource:name resources to the built-in redirect resources
+var abpResources = map[string]string{
+	"blank-text":            "nooptext",
+	"blank-css":             "noopcss",
+	"blank-js":              "noopjs",
+	"blank-html":            "noopframe",
+	"blank-mp3":             "noopmp3-0.1s",
+	"blank-mp4":             "noopmp4-1s",
+	"1x1-transparent-gif":   "1x1-transparent.gif",
+	"2x2-transparent-png":   "2x2-transparent.png",
+	"3x2-transparent-png":   "3x2-transparent.png",
+	"32x32-transparent-png": "32x32-transparent.png",
+}
+
+// redirectResources is the library of the built-in redirect resources. Key is the resource name.
+var redirectResources = map[string]*RedirectResource{}
+
+func init() {
+	resources := []*RedirectResource{
+		{Name: "1x1-transparent.gif", ContentType: "image/gif", Content: mustDecodeBase64(
+			"R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7")},
+		{Name: "2x2-transparent.png", ContentType: "image/png", Content: mustDecodeBase64(
+			"iVBORw0KGgoAAAANSUhEUgAAAAIAAAACCAYAAABytg0kAAAAC0lEQVR42mNgQAcAABIAAeRVjecAAAAASUVORK5CYII=")},
+		{Name: "3x2-transparent.png", ContentType: "image/png", Content: mustDecodeBase64(
+			"iVBORw0KGgoAAAANSUhEUgAAAAMAAAACCAYAAACddGYaAAAAC0lEQVR42mNgwAUAABoAAS+Yl6YAAAAASUVORK5CYII=")},
+		{Name: "32x32-transparent.png", ContentType: "image/png", Content: mustDecodeBase64(
+			"iVBORw0KGgoAAAANSUhEUgAAACAAAAAgCAYAAABzenr0AAAAGklEQVR42u3BAQEAAACCIP+vbkhAAQAAAO8GECAAAcm1w7EAAAAASUVORK5CYII=")},
+		{Name: "noopframe", ContentType: "text/html", Content: []byte(
+			"<!DOCTYPE html><html><head></head><body></body></html>")},
+		{Name: "noopcss", ContentType: "text/css", Content: []byte("")},
+		{Name: "noopjs", ContentType: "application/javascript", Content: []byte("(function() {})();")},
+		{Name: "noopjson", ContentType: "application/json", Content: []byte("{}")},
+		{Name: "nooptext", ContentType: "text/plain", Content: []byte("")},
+		{Name: "noopmp3-0.1s", ContentType: "audio/mpeg", Content: noopMP3()},
+		{Name: "noopmp4-1s", ContentType: "video/mp4", Content: noopMP4()},
+		{Name: "noopvast-2.0", ContentType: "application/xml", Content: []byte(
+			"<?xml version=\"1.0\" encoding=\"UTF-8\"?><VAST version=\"2.0\"></VAST>")},
+		{Name: "noopvast-3.0", ContentType: "application/xml", Content: []byte(
+			"<?xml version=\"1.0\" encoding=\"UTF-8\"?><VAST version=\"3.0\"></VAST>")},
+		{Name: "googletagmanager-googletagmanager", ContentType: "application/javascript", Content: []byte(
+			googleTagManagerStub)},
+		{Name: "google-analytics-ga", ContentType: "application/javascript", Content: []byte(
+			googleAnalyticsStub)},
+		{Name: "googlesyndication-adsbygoogle", ContentType: "application/javascript", Content: []byte(
+			adsByGoogleStub)},
+	}
+
+	for _, r := range resources {
+		redirectResources[r.Name] = r
+	}
+}
+
+// GetRedirectResource returns the redirect resource by its name
+// or nil if there is no such resource
+func GetRedirectResource(name string) *RedirectResource {
+	return redirectResources[name]
+}
+
+// mustDecodeBase64 decodes the base64 string and panics if it is invalid
+func mustDecodeBase64(str string) []byte {
+	b, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// noopMP3 returns 4 silent MPEG-1 Layer III frames (32 kbps, 44.1 kHz, mono), about 0.1 second long
+func noopMP3() []byte {
+	frame := make([]byte, 104)
+	copy(frame, []byte{0xFF, 0xFB, 0x10, 0xC4})
+	return bytes.Repeat(frame, 4)
+}
+
+// noopMP4 returns an MP4 file with a single track of 44 silent AAC-LC frames (44.1 kHz, mono).
+// The last frame is cut so that the track is exactly 1 second long.
+func noopMP4() []byte {
+	const (
+		timescale   = 44100
+		frameSize   = 1024
+		framesCount = 44
+	)
+	// A raw AAC-LC frame that decodes to silence
+	frame := []byte{0x00, 0xC8, 0x00, 0x80, 0x23, 0x80}
+	matrix := u32(0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000)
+
+	ftyp := mp4Box("ftyp", []byte("isom"), u32(0x200), []byte("isomiso2mp41"))
+	mvhd := mp4Box("mvhd", u32(0, 0, 0, 1000, 1000, 0x00010000), u16(0x0100, 0), u32(0, 0),
+		matrix, make([]byte, 24), u32(2))
+	tkhd := mp4Box("tkhd", u32(0x3, 0, 0, 1, 0, 1000, 0, 0), u16(0, 0, 0x0100, 0), matrix, u32(0, 0))
+	mdhd := mp4Box("mdhd", u32(0, 0, 0, timescale, timescale), u16(0x55C4, 0)) // "und" language
+	hdlr := mp4Box("hdlr", u32(0, 0), []byte("soun"), u32(0, 0, 0), []byte("SoundHandler\x00"))
+	dinf := mp4Box("dinf", mp4Box("dref", u32(0, 1), mp4Box("url ", u32(1))))
+
+	// ES descriptor: AAC-LC, 44.1 kHz, 1 channel
+	esds := mp4Box("esds", u32(0), []byte{
+		0x03, 0x19, 0x00, 0x01, 0x00,
+		0x04, 0x11, 0x40, 0x15, 0x00, 0x00, 0x00}, u32(0, 0), []byte{
+		0x05, 0x02, 0x12, 0x08,
+		0x06, 0x01, 0x02})
+	mp4a := mp4Box("mp4a", make([]byte, 6), u16(1), u32(0, 0), u16(1, 16, 0, 0), u32(timescale<<16), esds)
+	lastFrameDuration := timescale - (framesCount-1)*frameSize
+	stts := mp4Box("stts", u32(0, 2, framesCount-1, frameSize, 1, uint32(lastFrameDuration)))
+	stsc := mp4Box("stsc", u32(0, 1, 1, framesCount, 1))
+	stsz := mp4Box("stsz", u32(0, uint32(len(frame)), framesCount))
+
+	moov := func(mdatOffset uint32) []byte {
+		stco := mp4Box("stco", u32(0, 1, mdatOffset))
+		stbl := mp4Box("stbl", mp4Box("stsd", u32(0, 1), mp4a), stts, stsc, stsz, stco)
+		minf := mp4Box("minf", mp4Box("smhd", u32(0, 0)), dinf, stbl)
+		trak := mp4Box("trak", tkhd, mp4Box("mdia", mdhd, hdlr, minf))
+		return mp4Box("moov", mvhd, trak)
+	}
+
+	// The chunk offset does not change the size of the moov box
+	mdatOffset := uint32(len(ftyp) + len(moov(0)) + 8)
+	mdat := mp4Box("mdat", bytes.Repeat(frame, framesCount))
+	return bytes.Join([][]byte{ftyp, moov(mdatOffset), mdat}, nil)
+}
+
+// mp4Box builds an MP4 box of the specified type
+func mp4Box(boxType string, payload ...[]byte) []byte {
+	content := bytes.Join(payload, nil)
+	return bytes.Join([][]byte{u32(uint32(8 + len(content))), []byte(boxType), content}, nil)
+}
+
+// u32 encodes the values as big-endian 32-bit integers
+func u32(values ...uint32) []byte {
+	b := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(b[4*i:], v)
+	}
+	return b
+}
+
+// u16 encodes the values as big-endian 16-bit integers
+func u16(values ...uint16) []byte {
+	b := make([]byte, 2*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint16(b[2*i:], v)
+	}
+	return b
+}
+
+// googleTagManagerStub replaces googletagmanager.com/gtm.js
+// It calls the callbacks that the page passes to the data layer so that the page does not wait for them forever
+const googleTagManagerStub = `(function() {
+	var noopfn = function() {};
+	window.ga = window.ga || noopfn;
+	var dl = window.dataLayer;
+	if (!(dl instanceof Object)) {
+		return;
+	}
+	if (dl.hide instanceof Object && typeof dl.hide.end === 'function') {
+		dl.hide.end();
+	}
+	if (typeof dl.push === 'function') {
+		dl.push = function(o) {
+			if (o instanceof Object && typeof o.eventCallback === 'function') {
+				setTimeout(o.eventCallback, 1);
+			}
+		};
+	}
+})();`
+
+// googleAnalyticsStub replaces google-analytics.com/analytics.js
+const googleAnalyticsStub = `(function() {
+	var noopfn = function() {};
+	var Tracker = function() {};
+	Tracker.prototype.get = noopfn;
+	Tracker.prototype.set = noopfn;
+	Tracker.prototype.send = noopfn;
+	var ga = function() {
+		var args = arguments;
+		for (var i = 0; i < args.length; i++) {
+			if (args[i] instanceof Object && typeof args[i].hitCallback === 'function') {
+				setTimeout(args[i].hitCallback, 1);
+			}
+		}
+	};
+	ga.create = function() { return new Tracker(); };
+	ga.getByName = function() { return new Tracker(); };
+	ga.getAll = function() { return []; };
+	ga.remove = noopfn;
+	ga.loaded = true;
+	var name = window.GoogleAnalyticsObject || 'ga';
+	window[name] = ga;
+})();`
+
+// adsByGoogleStub replaces pagead2.googlesyndication.com/pagead/js/adsbygoogle.js
+const adsByGoogleStub = `(function() {
+	window.adsbygoogle = {
+		loaded: true,
+		push: function() {}
+	};
+})();`
@@ -0,0 +1,43 @@
+package urlfilter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRedirectResource(t *testing.T) {
+	r := GetRedirectResource("noopjs")
+	assert.NotNil(t, r)
+	assert.Equal(t, "noopjs", r.Name)
+	assert.Equal(t, "application/javascript", r.ContentType)
+	assert.Equal(t, "(function() {})();", string(r.Content))
+
+	r = GetRedirectResource("1x1-transparent.gif")
+	assert.NotNil(t, r)
+	assert.Equal(t, "image/gif", r.ContentType)
+	assert.Equal(t, "GIF89a", string(r.Content[:6]))
+
+	r = GetRedirectResource("32x32-transparent.png")
+	assert.NotNil(t, r)
+	assert.Equal(t, "\x89PNG", string(r.Content[:4]))
+
+	r = GetRedirectResource("noopmp3-0.1s")
+	assert.NotNil(t, r)
+	assert.Equal(t, 416, len(r.Content))
+
+	r = GetRedirectResource("noopmp4-1s")
+	assert.NotNil(t, r)
+	assert.Equal(t, 860, len(r.Content))
+	assert.Equal(t, "f72ca09a8c6cb8dedff02469e36095e84386e9485803d8ad52f33ce9fb308415",
+		fmt.Sprintf("%x", sha256.Sum256(r.Content)))
+	assert.Equal(t, "ftyp", string(r.Content[4:8]))
+	assert.True(t, bytes.Contains(r.Content, []byte("trak")))
+	assert.True(t, bytes.Contains(r.Content, []byte("soun")))
+
+	assert.NotNil(t, GetRedirectResource("googletagmanager-googletagmanager"))
+	assert.Nil(t, GetRedirectResource("unknown"))
+}
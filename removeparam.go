@@ -0,0 +1,130 @@
+package urlfilter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// removeParamModifier is the parsed value of the $removeparam modifier
+// https://kb.adguard.com/en/general/how-to-create-your-own-ad-filters#removeparam-modifier
+type removeParamModifier struct {
+	text     string         // original modifier value
+	name     string         // query parameter name. If both name and regex are empty, all parameters are removed.
+	regex    *regexp.Regexp // regular expression matching the "name=value" pair
+	inverted bool           // "~" -- remove all parameters except the matching ones
+}
+
+// parseRemoveParamModifier parses the $removeparam modifier value:
+// name, /regex/, /regex/i, or any of them prefixed with ~ to invert the rule
+func parseRemoveParamModifier(value string) (*removeParamModifier, error) {
+	m := &removeParamModifier{
+		text: value,
+	}
+
+	if strings.HasPrefix(value, "~") {
+		m.inverted = true
+		value = value[1:]
+		if value == "" {
+			return nil, fmt.Errorf("invalid $removeparam value: %s", m.text)
+		}
+	}
+
+	if !strings.HasPrefix(value, maskRegexRule) {
+		m.name = value
+		return m, nil
+	}
+
+	pattern := value[1:]
+	flags := ""
+	if strings.HasSuffix(pattern, "/i") {
+		pattern = pattern[:len(pattern)-2]
+		flags = "(?i)"
+	} else if strings.HasSuffix(pattern, maskRegexRule) {
+		pattern = pattern[:len(pattern)-1]
+	} else {
+		return nil, fmt.Errorf("invalid $removeparam regex: %s", m.text)
+	}
+
+	if pattern == "" {
+		return nil, fmt.Errorf("invalid $removeparam regex: %s", m.text)
+	}
+
+	re, err := regexp.Compile(flags + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $removeparam regex: %s", err)
+	}
+	m.regex = re
+
+	return m, nil
+}
+
+// match checks if the query parameter should be removed
+// param -- the "name=value" pair from the query string
+func (m *removeParamModifier) match(param string) bool {
+	var matched bool
+	if m.regex != nil {
+		matched = m.regex.MatchString(param)
+	} else {
+		name := param
+		if index := strings.IndexByte(param, '='); index >= 0 {
+			name = param[:index]
+		}
+		matched = m.name == "" || m.name == name
+	}
+
+	return matched != m.inverted
+}
+
+// GetCleanURL returns the request URL with the query parameters removed by the $removeparam rules.
+// It returns the original URL if there is nothing to remove.
+func (m *MatchingResult) GetCleanURL(r *Request) string {
+	if len(m.RemoveParamRules) == 0 {
+		return r.URL
+	}
+
+	// The fragment goes after the query and can contain "?" as well
+	base := r.URL
+	fragment := ""
+	if fragmentIndex := strings.IndexByte(base, '#'); fragmentIndex >= 0 {
+		fragment = base[fragmentIndex:]
+		base = base[:fragmentIndex]
+	}
+
+	queryIndex := strings.IndexByte(base, '?')
+	if queryIndex == -1 {
+		return r.URL
+	}
+
+	query := base[queryIndex+1:]
+	base = base[:queryIndex]
+
+	var params []string
+	removed := false
+	for _, param := range strings.Split(query, "&") {
+		if param != "" && m.isParamRemoved(param) {
+			removed = true
+			continue
+		}
+		params = append(params, param)
+	}
+
+	if !removed {
+		return r.URL
+	}
+
+	if len(params) == 0 {
+		return base + fragment
+	}
+	return base + "?" + strings.Join(params, "&") + fragment
+}
+
+// isParamRemoved checks if any of the $removeparam rules removes the query parameter
+func (m *MatchingResult) isParamRemoved(param string) bool {
+	for _, rule := range m.RemoveParamRules {
+		if rule.removeParam.match(param) {
+			return true
+		}
+	}
+	return false
+}
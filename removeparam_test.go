@@ -0,0 +1,95 @@
+package urlfilter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRemoveParamModifier(t *testing.T) {
+	m, err := parseRemoveParamModifier("fbclid")
+	assert.Nil(t, err)
+	assert.True(t, m.match("fbclid=123"))
+	assert.True(t, m.match("fbclid"))
+	assert.False(t, m.match("fbclid2=123"))
+
+	m, err = parseRemoveParamModifier("/^utm_/")
+	assert.Nil(t, err)
+	assert.True(t, m.match("utm_source=test"))
+	assert.False(t, m.match("UTM_source=test"))
+
+	m, err = parseRemoveParamModifier("/^utm_/i")
+	assert.Nil(t, err)
+	assert.True(t, m.match("UTM_source=test"))
+
+	m, err = parseRemoveParamModifier("~id")
+	assert.Nil(t, err)
+	assert.False(t, m.match("id=1"))
+	assert.True(t, m.match("page=1"))
+
+	m, err = parseRemoveParamModifier("")
+	assert.Nil(t, err)
+	assert.True(t, m.match("page=1"))
+
+	_, err = parseRemoveParamModifier("~")
+	assert.NotNil(t, err)
+	_, err = parseRemoveParamModifier("/utm_")
+	assert.NotNil(t, err)
+	_, err = parseRemoveParamModifier("//")
+	assert.NotNil(t, err)
+	_, err = parseRemoveParamModifier("/(/")
+	assert.NotNil(t, err)
+}
+
+func TestMatchingResultRemoveParam(t *testing.T) {
+	utmRule, err := NewNetworkRule("$removeparam=/^utm_/", -1)
+	assert.Nil(t, err)
+	fbclidRule, err := NewNetworkRule("||example.org^$removeparam=fbclid", -1)
+	assert.Nil(t, err)
+
+	r := NewRequest("https://example.org/page?id=1&utm_source=test&fbclid=abc#top", "", TypeDocument)
+
+	// $removeparam rules do not block the request
+	res := NewMatchingResult([]*NetworkRule{utmRule, fbclidRule}, nil)
+	assert.Nil(t, res.GetBasicResult())
+	assert.Equal(t, "https://example.org/page?id=1#top", res.GetCleanURL(r))
+
+	// Nothing to remove
+	r2 := NewRequest("https://example.org/page?id=1", "", TypeDocument)
+	assert.Equal(t, r2.URL, res.GetCleanURL(r2))
+
+	// "?" in the fragment does not start the query
+	r2 = NewRequest("https://example.org/page#top?fbclid=abc", "", TypeDocument)
+	assert.Equal(t, r2.URL, res.GetCleanURL(r2))
+	r2 = NewRequest("https://example.org/page?fbclid=abc#top?utm_source=test", "", TypeDocument)
+	assert.Equal(t, "https://example.org/page#top?utm_source=test", res.GetCleanURL(r2))
+
+	// All parameters are removed
+	r2 = NewRequest("https://example.org/page?fbclid=abc", "", TypeDocument)
+	assert.Equal(t, "https://example.org/page", res.GetCleanURL(r2))
+
+	// Whitelist rule disables the rule with the same value
+	whitelistRule, err := NewNetworkRule("@@||example.org^$removeparam=/^utm_/", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{utmRule, fbclidRule, whitelistRule}, nil)
+	assert.Equal(t, "https://example.org/page?id=1&utm_source=test#top", res.GetCleanURL(r))
+
+	// Whitelist rule without a value disables all of them
+	whitelistRule, err = NewNetworkRule("@@||example.org^$removeparam", -1)
+	assert.Nil(t, err)
+	res = NewMatchingResult([]*NetworkRule{utmRule, fbclidRule, whitelistRule}, nil)
+	assert.Equal(t, r.URL, res.GetCleanURL(r))
+}
+
+func TestEngineRemoveParam(t *testing.T) {
+	rulesText := "$removeparam=/^utm_/\n@@||example.com^$removeparam"
+	engine := NewEngine(newTestRuleStorage(t, -1, rulesText))
+
+	r := NewRequest("https://example.org/?utm_source=test&q=1", "", TypeDocument)
+	res := engine.Match(r)
+	assert.Equal(t, "https://example.org/?q=1", res.GetCleanURL(r))
+
+	r = NewRequest("https://example.com/?utm_source=test&q=1", "", TypeDocument)
+	res = engine.Match(r)
+	assert.Equal(t, r.URL, res.GetCleanURL(r))
+}
@@ -0,0 +1,121 @@
+package urlfilter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// replaceModifier is the parsed value of the $replace modifier: /regex/replacement/flags
+// https://kb.adguard.com/en/general/how-to-create-your-own-ad-filters#replace-modifier
+type replaceModifier struct {
+	text        string         // original modifier value
+	regex       *regexp.Regexp // regular expression to search for
+	replacement string         // replacement, can contain $1-like references to the capturing groups
+	global      bool           // "g" flag -- replace all occurrences instead of the first one
+}
+
+// parseReplaceModifier parses the $replace modifier value.
+// Slashes inside the regex and the replacement must be escaped with a backslash.
+func parseReplaceModifier(value string) (*replaceModifier, error) {
+	if len(value) < 2 || value[0] != '/' {
+		return nil, fmt.Errorf("invalid $replace value: %s", value)
+	}
+
+	var parts []string
+	var sb strings.Builder
+	for i := 1; i < len(value); i++ {
+		c := value[i]
+
+		if c == escapeCharacter && i+1 < len(value) && value[i+1] == '/' {
+			sb.WriteByte('/')
+			i++
+		} else if c == '/' && len(parts) < 2 {
+			parts = append(parts, sb.String())
+			sb.Reset()
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	parts = append(parts, sb.String())
+
+	if len(parts) != 3 || parts[0] == "" {
+		return nil, fmt.Errorf("invalid $replace value: %s", value)
+	}
+
+	m := &replaceModifier{
+		text:        value,
+		replacement: parts[1],
+	}
+
+	regexFlags := ""
+	for _, flag := range parts[2] {
+		switch flag {
+		case 'g':
+			m.global = true
+		case 'i', 'm', 's':
+			regexFlags += string(flag)
+		default:
+			return nil, fmt.Errorf("invalid $replace flag: %c", flag)
+		}
+	}
+
+	pattern := parts[0]
+	if regexFlags != "" {
+		pattern = "(?" + regexFlags + ")" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $replace regex: %s", err)
+	}
+	m.regex = re
+
+	return m, nil
+}
+
+// apply replaces the matching content of the specified body
+func (m *replaceModifier) apply(body []byte) []byte {
+	if m.global {
+		return m.regex.ReplaceAll(body, []byte(m.replacement))
+	}
+
+	loc := m.regex.FindSubmatchIndex(body)
+	if loc == nil {
+		return body
+	}
+
+	result := make([]byte, 0, len(body))
+	result = append(result, body[:loc[0]]...)
+	result = m.regex.Expand(result, []byte(m.replacement), body, loc)
+	result = append(result, body[loc[1]:]...)
+	return result
+}
+
+// ApplyReplaceRules applies the $replace rules to the response body.
+// Whitelist rules are ignored here, use MatchingResult.ReplaceRules to get
+// the list of rules that are not disabled by them.
+// The rules are applied in the order they are written in: by the filter list ID and then
+// by the rule position in the list.
+func ApplyReplaceRules(rules []*NetworkRule, body []byte) []byte {
+	var replaceRules []*NetworkRule
+	for _, rule := range rules {
+		if !rule.Whitelist && rule.replace != nil {
+			replaceRules = append(replaceRules, rule)
+		}
+	}
+
+	sort.SliceStable(replaceRules, func(i, j int) bool {
+		if replaceRules[i].FilterListID != replaceRules[j].FilterListID {
+			return replaceRules[i].FilterListID < replaceRules[j].FilterListID
+		}
+		return replaceRules[i].storageIdx < replaceRules[j].storageIdx
+	})
+
+	for _, rule := range replaceRules {
+		body = rule.replace.apply(body)
+	}
+
+	return body
+}
@@ -0,0 +1,81 @@
+package urlfilter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReplaceModifier(t *testing.T) {
+	m, err := parseReplaceModifier("/<VAST[\\s\\S]*?>[\\s\\S]*<\\/VAST>/<VAST version=\"3.0\"><\\/VAST>/i")
+	assert.Nil(t, err)
+	assert.NotNil(t, m)
+	assert.Equal(t, "<VAST version=\"3.0\"></VAST>", m.replacement)
+	assert.False(t, m.global)
+	assert.True(t, m.regex.MatchString("<vast version=\"2.0\"><Ad></Ad></vast>"))
+
+	m, err = parseReplaceModifier("/ad//g")
+	assert.Nil(t, err)
+	assert.NotNil(t, m)
+	assert.Equal(t, "", m.replacement)
+	assert.True(t, m.global)
+
+	_, err = parseReplaceModifier("ad//")
+	assert.NotNil(t, err)
+	_, err = parseReplaceModifier("/ad/")
+	assert.NotNil(t, err)
+	_, err = parseReplaceModifier("///")
+	assert.NotNil(t, err)
+	_, err = parseReplaceModifier("/ad//x")
+	assert.NotNil(t, err)
+	_, err = parseReplaceModifier("/(ad//")
+	assert.NotNil(t, err)
+}
+
+func TestReplaceModifierApply(t *testing.T) {
+	m, err := parseReplaceModifier("/(\\d+)/[$1]/")
+	assert.Nil(t, err)
+	assert.Equal(t, "a[1] b2", string(m.apply([]byte("a1 b2"))))
+	assert.Equal(t, "ab", string(m.apply([]byte("ab"))))
+
+	m, err = parseReplaceModifier("/(\\d+)/[$1]/g")
+	assert.Nil(t, err)
+	assert.Equal(t, "a[1] b[2]", string(m.apply([]byte("a1 b2"))))
+}
+
+func TestApplyReplaceRules(t *testing.T) {
+	rule1, err := NewNetworkRule("||example.org^$replace=/a/b/g", 2)
+	assert.Nil(t, err)
+	rule2, err := NewNetworkRule("||example.org^$replace=/b/c/g", 1)
+	assert.Nil(t, err)
+	whitelistRule, err := NewNetworkRule("@@||example.org^$replace", 1)
+	assert.Nil(t, err)
+
+	// rule2 goes first because of the filter list ID
+	body := ApplyReplaceRules([]*NetworkRule{rule1, rule2, whitelistRule}, []byte("abc"))
+	assert.Equal(t, "bcc", string(body))
+}
+
+func TestApplyReplaceRulesOrder(t *testing.T) {
+	// Applied alphabetically, these rules would turn "a" into "c"
+	rulesText := "||example.org^$replace=/b/c/\n||example.org^$replace=/a/b/"
+	engine := NewEngine(newTestRuleStorage(t, 1, rulesText))
+
+	res := engine.Match(NewRequest("https://example.org/", "", TypeDocument))
+	assert.Len(t, res.ReplaceRules, 2)
+	assert.Equal(t, "b", string(res.ApplyReplaceRules([]byte("a"))))
+
+	// The order of the matching rules does not matter
+	rules := []*NetworkRule{res.ReplaceRules[1], res.ReplaceRules[0]}
+	assert.Equal(t, "b", string(ApplyReplaceRules(rules, []byte("a"))))
+}
+
+func TestApplyReplaceRulesOrderOtherRules(t *testing.T) {
+	// The second rule has no shortcut, so the engine keeps it in the other rules
+	rulesText := "||example.org^$replace=/a/b/\n/exam/$replace=/b/c/"
+	engine := NewEngine(newTestRuleStorage(t, 1, rulesText))
+
+	res := engine.Match(NewRequest("https://example.org/", "", TypeDocument))
+	assert.Len(t, res.ReplaceRules, 2)
+	assert.Equal(t, "c", string(res.ApplyReplaceRules([]byte("a"))))
+}
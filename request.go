@@ -1,6 +1,7 @@
 package urlfilter
 
 import (
+	"net"
 	"strings"
 
 	"golang.org/x/net/publicsuffix"
@@ -34,11 +35,22 @@ const (
 	TypeWebsocket
 	// TypeOther - any other request type
 	TypeOther
+	// TypePing (navigator.sendBeacon() or ping attribute on links) $ping
+	TypePing
+	// TypeCSPReport (Content-Security-Policy violation report) $csp_report
+	TypeCSPReport
+	// TypeWebRTC (a WebRTC connection) $webrtc
+	TypeWebRTC
+
+	// TypeDNS marks the DNS queries (and other hostname-only requests).
+	// Rules limited to specific request types never match them.
+	TypeDNS
 
 	// TypeAllRequestTypes combines all other request type flags
+	// except for TypeDNS which is not a web request type
 	TypeAllRequestTypes = TypeDocument | TypeSubdocument | TypeScript | TypeStylesheet |
 		TypeObject | TypeImage | TypeXmlhttprequest | TypeObjectSubrequest | TypeMedia |
-		TypeFont | TypeWebsocket | TypeOther
+		TypeFont | TypeWebsocket | TypeOther | TypePing | TypeCSPReport | TypeWebRTC
 )
 
 // Request represents a web request with all it's necessary properties
@@ -51,6 +63,14 @@ type Request struct {
 	// This can be true for DNS requests, or for HTTP CONNECT, or SNI matching.
 	IsHostnameRequest bool
 
+	Method string // HTTP method of the request (GET, POST, etc). Can be empty if unknown.
+	App    string // Identifier of the application that sent the request (package or process name). Can be empty if unknown.
+
+	ClientIP   net.IP   // IP address of the client that sent the request. Can be nil if unknown.
+	ClientName string   // Name of the client that sent the request. Can be empty if unknown.
+	ClientTags []string // Tags of the client that sent the request
+	DNSType    uint16   // Type of the DNS query (DNSTypeA, DNSTypeAAAA, etc). 0 if this is not a DNS request.
+
 	URL          string // Request URL
 	URLLowerCase string // Request URL in lower case
 	Hostname     string // Request hostname
@@ -96,10 +116,10 @@ func NewRequest(url string, sourceURL string, requestType RequestType) *Request
 }
 
 // NewRequestForHostname creates a new instance of "Request" for matching hostname.
-// It uses "http://" as a protocol and TypeDocument as a request type.
+// It uses "http://" as a protocol and TypeDNS as a request type.
 func NewRequestForHostname(hostname string) *Request {
 	r := Request{
-		RequestType:       TypeDocument,
+		RequestType:       TypeDNS,
 		URL:               "http://" + hostname,
 		URLLowerCase:      "http://" + hostname,
 		Hostname:          hostname,
@@ -16,6 +16,22 @@ func (e *RuleSyntaxError) Error() string {
 	return fmt.Sprintf("syntax error: %s, rule: %s", e.msg, e.ruleText)
 }
 
+// UnsupportedModifierError signals that the rule uses a modifier (usually an uBlock Origin
+// or Adblock Plus alias) that does not have an exact equivalent in this library
+type UnsupportedModifierError struct {
+	Modifier string // Modifier is the name of the unsupported modifier
+	Reason   string // Reason explains why it is not supported
+}
+
+func (e *UnsupportedModifierError) Error() string {
+	return fmt.Sprintf("unsupported modifier $%s: %s", e.Modifier, e.Reason)
+}
+
+// Unwrap allows checking the error with errors.Is(err, ErrUnsupportedRule)
+func (e *UnsupportedModifierError) Unwrap() error {
+	return ErrUnsupportedRule
+}
+
 var (
 	// ErrUnsupportedRule signals that this might be a valid rule type,
 	// but it is not yet supported by this library
@@ -48,6 +64,11 @@ func NewRule(line string, filterListID int) (Rule, error) {
 		return NewCosmeticRule(line, filterListID)
 	}
 
+	// The DNS engine converts these lines to host rules itself, see NewDNSEngine
+	if isWildcardJustDomain(line) {
+		return NewNetworkRule(line, filterListID)
+	}
+
 	f, err := NewHostRule(line, filterListID)
 	if err == nil {
 		return f, nil
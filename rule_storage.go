@@ -89,6 +89,10 @@ func (s *RuleStorage) RetrieveRule(storageIdx int64) (Rule, error) {
 
 	f, err := list.RetrieveRule(int(ruleIdx))
 	if f != nil {
+		if networkRule, ok := f.(*NetworkRule); ok {
+			// Keep the position of the rule, the order matters for some of the rules ($replace)
+			networkRule.storageIdx = storageIdx
+		}
 		s.cache[storageIdx] = f
 	}
 
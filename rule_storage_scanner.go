@@ -53,7 +53,13 @@ func (s *RuleStorageScanner) Rule() (Rule, int64) {
 		return nil, 0
 	}
 
-	return f, ruleListIdxToStorageIdx(int32(f.GetFilterListID()), int32(idx))
+	storageIdx := ruleListIdxToStorageIdx(int32(f.GetFilterListID()), int32(idx))
+	if networkRule, ok := f.(*NetworkRule); ok {
+		// Engines keep some of the scanned rules as is (see NetworkEngine.otherRules)
+		// so the position must be set here, not only in RuleStorage.RetrieveRule
+		networkRule.storageIdx = storageIdx
+	}
+	return f, storageIdx
 }
 
 // ruleListIdxToStorageIdx converts pair of listID and rule list index
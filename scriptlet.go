@@ -0,0 +1,124 @@
+package urlfilter
+
+import (
+	"errors"
+	"strings"
+)
+
+// scriptletMask is the prefix of the scriptlet rule content
+const scriptletMask = "//scriptlet("
+
+// Scriptlet represents a parsed scriptlet call
+// https://kb.adguard.com/en/general/how-to-create-your-own-ad-filters#scriptlets
+type Scriptlet struct {
+	Name string   // Name is the scriptlet name
+	Args []string // Args is the list of the scriptlet arguments
+}
+
+// parseScriptlet parses the content of a scriptlet rule.
+// The format is: //scriptlet('name', 'arg1', 'arg2', ...)
+// Arguments can be enclosed in single or double quotes,
+// quotes inside of them can be escaped with a backslash.
+func parseScriptlet(content string) (*Scriptlet, error) {
+	if !strings.HasPrefix(content, scriptletMask) || !strings.HasSuffix(content, ")") {
+		return nil, errors.New("invalid scriptlet call")
+	}
+
+	args, err := parseScriptletArgs(content[len(scriptletMask) : len(content)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 0 || args[0] == "" {
+		return nil, errors.New("scriptlet name is empty")
+	}
+
+	return &Scriptlet{
+		Name: args[0],
+		Args: args[1:],
+	}, nil
+}
+
+// parseScriptletArgs splits the comma-separated list of quoted arguments
+// and returns them unquoted and unescaped
+func parseScriptletArgs(str string) ([]string, error) {
+	var args []string
+
+	i := skipSpaces(str, 0)
+	for i < len(str) {
+		quote := str[i]
+		if quote != '\'' && quote != '"' {
+			return nil, errors.New("scriptlet argument must be quoted")
+		}
+
+		var sb strings.Builder
+		closed := false
+		for i++; i < len(str); i++ {
+			c := str[i]
+			if c == escapeCharacter && i+1 < len(str) {
+				i++
+				sb.WriteByte(str[i])
+			} else if c == quote {
+				closed = true
+				i++
+				break
+			} else {
+				sb.WriteByte(c)
+			}
+		}
+
+		if !closed {
+			return nil, errors.New("unclosed scriptlet argument")
+		}
+		args = append(args, sb.String())
+
+		i = skipSpaces(str, i)
+		if i == len(str) {
+			break
+		}
+		if str[i] != ',' {
+			return nil, errors.New("scriptlet arguments must be separated by comma")
+		}
+		i = skipSpaces(str, i+1)
+		if i == len(str) {
+			return nil, errors.New("scriptlet argument is missing")
+		}
+	}
+
+	return args, nil
+}
+
+// skipSpaces returns the index of the first non-space character starting from i
+func skipSpaces(str string, i int) int {
+	for i < len(str) && str[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+// String returns the canonical text representation of the scriptlet call.
+// All the arguments are enclosed in single quotes.
+func (s *Scriptlet) String() string {
+	var sb strings.Builder
+	sb.WriteString(scriptletMask)
+	writeScriptletArg(&sb, s.Name)
+	for _, arg := range s.Args {
+		sb.WriteString(", ")
+		writeScriptletArg(&sb, arg)
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// writeScriptletArg writes the argument enclosed in single quotes
+func writeScriptletArg(sb *strings.Builder, arg string) {
+	sb.WriteByte('\'')
+	for i := 0; i < len(arg); i++ {
+		c := arg[i]
+		if c == '\'' || c == escapeCharacter {
+			sb.WriteByte(escapeCharacter)
+		}
+		sb.WriteByte(c)
+	}
+	sb.WriteByte('\'')
+}
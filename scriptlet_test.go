@@ -0,0 +1,51 @@
+package urlfilter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScriptlet(t *testing.T) {
+	s, err := parseScriptlet("//scriptlet('abort-on-property-read', 'alert')")
+	assert.Nil(t, err)
+	assert.NotNil(t, s)
+	assert.Equal(t, "abort-on-property-read", s.Name)
+	assert.Equal(t, []string{"alert"}, s.Args)
+
+	s, err = parseScriptlet("//scriptlet(\"set-constant\",\"first.second\" , 'false')")
+	assert.Nil(t, err)
+	assert.NotNil(t, s)
+	assert.Equal(t, "set-constant", s.Name)
+	assert.Equal(t, []string{"first.second", "false"}, s.Args)
+	assert.Equal(t, "//scriptlet('set-constant', 'first.second', 'false')", s.String())
+
+	s, err = parseScriptlet("//scriptlet('prevent-adfly')")
+	assert.Nil(t, err)
+	assert.NotNil(t, s)
+	assert.Equal(t, "prevent-adfly", s.Name)
+	assert.Empty(t, s.Args)
+
+	// Quotes and escapes
+	s, err = parseScriptlet("//scriptlet('log', 'it\\'s', \"a, \\\"b\\\"\", 'c\\\\d')")
+	assert.Nil(t, err)
+	assert.NotNil(t, s)
+	assert.Equal(t, []string{"it's", "a, \"b\"", "c\\d"}, s.Args)
+	assert.Equal(t, "//scriptlet('log', 'it\\'s', 'a, \"b\"', 'c\\\\d')", s.String())
+
+	// Invalid scriptlets
+	invalid := []string{
+		"//scriptlet()",
+		"//scriptlet('')",
+		"//scriptlet(abort-on-property-read)",
+		"//scriptlet('abort-on-property-read', alert)",
+		"//scriptlet('abort-on-property-read' 'alert')",
+		"//scriptlet('abort-on-property-read',)",
+		"//scriptlet('abort-on-property-read', 'alert)",
+		"//scriptlet('abort-on-property-read'",
+	}
+	for _, content := range invalid {
+		_, err = parseScriptlet(content)
+		assert.NotNil(t, err, content)
+	}
+}